@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/codecat/go-libs/log"
+	"github.com/spf13/viper"
+)
+
+// toolchain contains the options that the compiler was chosen with.
+var toolchain ToolchainOptions
+
+// loadProject loads the configuration and prepares a context for each configuration that has to be built.
+func loadProject() ([]*Context, []*Configuration) {
+	// Load a qb.toml file, if it exists
+	err := loadConfig()
+	if err != nil {
+		log.Fatal("Unable to read configuration file: %s", err.Error())
+		os.Exit(1)
+	}
+
+	// Find the compiler to use
+	toolchain = newToolchainOptions()
+	compiler, err := findCompiler(toolchain)
+	if err != nil {
+		log.Fatal("Unable to initialize compiler: %s (run \"qb doctor\" for help)", err.Error())
+		os.Exit(1)
+	}
+
+	// Apply configuration specific to the toolset of the compiler
+	err = applyToolsetConfig(compiler.Toolset())
+	if err != nil {
+		log.Fatal("Unable to apply toolset configuration: %s", err.Error())
+		os.Exit(1)
+	}
+
+	// Find all configurations that we have to build
+	configs, err := getConfigurations()
+	if err != nil {
+		log.Fatal("Unable to load configurations: %s", err.Error())
+		os.Exit(1)
+	}
+
+	// Prepare qb's internal context for each configuration
+	contexts := make([]*Context, 0, len(configs))
+	for _, config := range configs {
+		ctx := NewContext(compiler)
+		loadContext(ctx, config)
+		contexts = append(contexts, ctx)
+	}
+
+	return contexts, configs
+}
+
+// prepareBuild finds the source files and loads the compiler options of each configuration. Conan dependencies are
+// only installed if installConan is true.
+func prepareBuild(contexts []*Context, configs []*Configuration, installConan bool) {
+	// To support Conan: run "conan install", if a conanfile exists, but conanbuildinfo.txt does not exist
+	if installConan && fileExists("conanfile.txt") && !fileExists("conanbuildinfo.txt") {
+		log.Info("Conanfile found: installing dependencies from Conan")
+		err := exec.Command("conan", "install", ".").Run()
+		if err != nil {
+			log.Warn("Conan install failed: %s", err.Error())
+		}
+	}
+
+	// To support Conan: use conanbuildinfo.txt, if it exists
+	var conan Conanfile
+	if fileExists("conanbuildinfo.txt") {
+		var err error
+		conan, err = loadConanFile("conanbuildinfo.txt")
+		if err != nil {
+			log.Warn("Unable to load conanbuildinfo.txt: %s", err.Error())
+		}
+	}
+
+	// Find all the source files to compile
+	_, resources := contexts[0].Compiler.(ResourceCompiler)
+	sourceFiles, err := getSourceFiles(resources)
+	if err != nil {
+		log.Fatal("Unable to read directory: %s", err.Error())
+		os.Exit(1)
+	}
+
+	// Load the compiler options of each configuration
+	for i, ctx := range contexts {
+		loadCompilerOptions(ctx, configs[i], conan)
+		ctx.SourceFiles = sourceFiles
+		ctx.CompilerOptions.Languages = sourceLanguages(sourceFiles)
+		resolvePCHLanguages(ctx.CompilerOptions)
+
+		err := checkSanitizers(ctx.CompilerOptions)
+		if err == nil {
+			err = checkSplitDWARF(ctx.Type, ctx.CompilerOptions)
+		}
+		if err == nil {
+			err = ctx.Compiler.ValidateOptions(ctx.CompilerOptions)
+		}
+		if err != nil {
+			log.Fatal("%sUnable to build with these options: %s", ctx.logPrefix(), err.Error())
+			os.Exit(1)
+		}
+	}
+
+	// Stop if there were problems in the configuration and we're being strict about it
+	if viper.GetBool("strict-config") && len(configIssues) > 0 {
+		log.Fatal("😢 Found %d problem(s) in the configuration!", len(configIssues))
+		os.Exit(1)
+	}
+}
+
+// buildAll builds all configurations at the same time, and reports the results of each configuration. It returns
+// false if any of the configurations failed to build.
+func buildAll(contexts []*Context) ([]*buildResult, bool) {
+	// Make a temporary folder for .obj files. gcc finds the profiles for profile-guided optimization by the paths of
+	// the object files, so those builds always use the same folder.
+	objectPath := filepath.Join(os.TempDir(), fmt.Sprintf("qb_%d", time.Now().Unix()))
+	if contexts[0].CompilerOptions.PGO != PGOOff {
+		objectPath, _ = filepath.Abs(filepath.Join(pgoStatePath, "obj"))
+		os.RemoveAll(objectPath)
+	}
+	os.Mkdir(objectPath, 0777)
+	defer os.RemoveAll(objectPath)
+
+	return buildAllIn(contexts, objectPath)
+}
+
+// buildAllIn builds all configurations like buildAll, but puts the object files in the given directory, which is
+// left for the caller to remove.
+func buildAllIn(contexts []*Context, objectPath string) ([]*buildResult, bool) {
+	if len(contexts[0].SourceFiles) == 0 {
+		log.Warn("No source files found!")
+		return nil, false
+	}
+
+	// Start the compiler workers, which are shared by all configurations
+	workers := startCompilerWorkers()
+	defer close(workers)
+
+	// Build all configurations at the same time
+	results := make([]*buildResult, len(contexts))
+	var wg sync.WaitGroup
+	for i, ctx := range contexts {
+		ctx.ObjectPath = filepath.Join(objectPath, ctx.ConfigurationName)
+		ctx.CompilerWorkerChannel = workers
+
+		wg.Add(1)
+		go func(i int, ctx *Context) {
+			defer wg.Done()
+			results[i] = build(ctx)
+		}(i, ctx)
+	}
+	wg.Wait()
+
+	// Report the results of each configuration
+	ok := true
+	for _, res := range results {
+		prefix := res.ctx.logPrefix()
+		if res.err != nil {
+			ok = false
+			log.Fatal("😢 %s%s", prefix, res.err.Error())
+			continue
+		}
+		log.Info("👏 %s%s", prefix, res.outPath)
+		log.Info("⏳ %scompile %v, link %v", prefix, res.timeCompilation, res.timeLinking)
+	}
+
+	return results, ok
+}
+
+// buildResult contains the outcome of building a single configuration.
+type buildResult struct {
+	ctx             *Context
+	outPath         string
+	err             error
+	timeCompilation time.Duration
+	timeLinking     time.Duration
+}
+
+// build compiles and links a single configuration.
+func build(ctx *Context) *buildResult {
+	res := &buildResult{ctx: ctx}
+
+	// Make sure the output directory exists
+	if ctx.OutPath != "" {
+		err := os.MkdirAll(ctx.OutPath, 0777)
+		if err != nil {
+			res.err = fmt.Errorf("Unable to create output directory %s: %s", ctx.OutPath, err.Error())
+			return res
+		}
+	}
+
+	// Perform the compilation
+	timeStart := time.Now()
+	performCompilation(ctx)
+	res.timeCompilation = time.Since(timeStart)
+
+	// Stop if there were any compiler errors
+	if ctx.CompilerErrors.Load() > 0 {
+		res.err = errors.New("Compilation failed!")
+		return res
+	}
+
+	// Perform the linking
+	timeStart = time.Now()
+	outPath, err := performLinking(ctx)
+	res.timeLinking = time.Since(timeStart)
+
+	// Stop if linking failed
+	if err != nil {
+		res.err = fmt.Errorf("Link failed!\n%s", err.Error())
+		return res
+	}
+
+	res.outPath = outPath
+	return res
+}
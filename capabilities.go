@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// cppStandardNames are the names that -std= accepts for each C++ standard. Older compilers only know the
+// provisional names, like "c++2b" for C++23.
+var cppStandardNames = map[CPPStandardType][]string{
+	CPPStandard26: {"c++26", "c++2c"},
+	CPPStandard23: {"c++23", "c++2b"},
+	CPPStandard20: {"c++20", "c++2a"},
+	CPPStandard17: {"c++17", "c++1z"},
+	CPPStandard14: {"c++14", "c++1y"},
+}
+
+// cppStandardOrder are the C++ standards from newest to oldest.
+var cppStandardOrder = []CPPStandardType{CPPStandard26, CPPStandard23, CPPStandard20, CPPStandard17, CPPStandard14}
+
+// cStandardNames are the names that -std= accepts for each C standard.
+var cStandardNames = map[CStandardType][]string{
+	CStandard23: {"c23", "c2x"},
+	CStandard17: {"c17", "c18"},
+	CStandard11: {"c11", "c1x"},
+}
+
+// cStandardOrder are the C standards from newest to oldest.
+var cStandardOrder = []CStandardType{CStandard23, CStandard17, CStandard11}
+
+// compilerCapabilities contains what a gcc style compiler supports. Support for a flag is only probed the first time
+// it's needed, and the results are remembered in a cache file, so that a compiler only has to be probed once.
+type compilerCapabilities struct {
+	// key identifies the compiler in the cache, by its path, version, and target arguments.
+	key string
+
+	// family is the compiler family, either "clang" or "gcc".
+	family string
+
+	// cc and cxx are the commands of the C and C++ compilers, and args are the arguments that select the target.
+	cc   []string
+	cxx  []string
+	args []string
+
+	// flags contains the result of each probe, such as whether a flag is supported.
+	flags map[string]bool
+
+	// runProbe runs a command with the source code on its standard input, and returns true if it succeeds. Tests
+	// replace it to pretend to be a compiler.
+	runProbe func(command []string, source string) bool
+
+	mutex sync.Mutex
+}
+
+// newCompilerCapabilities prepares the capabilities of a compiler, loading what is already known from the cache.
+func newCompilerCapabilities(cc, cxx []string, info compilerInfo, args []string) *compilerCapabilities {
+	path, err := exec.LookPath(cc[len(cc)-1])
+	if err == nil {
+		path, _ = filepath.Abs(path)
+	}
+
+	ret := &compilerCapabilities{
+		key:    strings.Join(slices.Concat(cc[:len(cc)-1], []string{path, info.version}, args), " "),
+		family: info.family,
+		cc:     cc,
+		cxx:    cxx,
+		args:   args,
+		flags:  make(map[string]bool),
+
+		runProbe: runProbe,
+	}
+
+	if cache, err := loadCapabilitiesCache(); err == nil {
+		for flag, supported := range cache[ret.key] {
+			ret.flags[flag] = supported
+		}
+	}
+	return ret
+}
+
+// supportsFlag returns true if the compiler accepts the given flag for the given language, either "c" or "c++".
+func (caps *compilerCapabilities) supportsFlag(language, flag string) bool {
+	compiler := caps.cc
+	if language == "c++" {
+		compiler = caps.cxx
+	}
+
+	// Check the flag against an empty source file
+	return caps.probe(language+" "+flag, compiler, []string{flag, "-x", language, "-fsyntax-only", "-"}, "")
+}
+
+// supportsStdLib returns true if a C++ program can be built with the given C++ standard library, which also makes
+// sure that the library is installed.
+func (caps *compilerCapabilities) supportsStdLib(stdlib string, static bool) bool {
+	key := "stdlib " + stdlib
+	args := []string{"-stdlib=" + stdlib, "-x", "c++", "-", "-o", os.DevNull}
+	if static {
+		key += " static"
+		args = append(args, "-static")
+		if stdlib == "libc++" {
+			args = append(args, "-lc++abi")
+		}
+	}
+	return caps.probe(key, caps.cxx, args, "#include <string>\nint main() { return (int)std::string(\"qb\").size(); }\n")
+}
+
+// supportsLinker returns true if a program can be linked with the given linker, which also makes sure that the
+// linker is installed.
+func (caps *compilerCapabilities) supportsLinker(linker string) bool {
+	args := []string{"-fuse-ld=" + linker, "-x", "c", "-", "-o", os.DevNull}
+	return caps.probe("linker "+linker, caps.cc, args, "int main(void) { return 0; }\n")
+}
+
+// ltoFlag returns the flag that enables link-time optimization for both compiling and linking. gcc doesn't have a
+// thin mode, so it always uses its own parallel mode.
+func (caps *compilerCapabilities) ltoFlag(lto LTOType) string {
+	switch {
+	case lto == LTOOff:
+		return ""
+	case caps.family == "gcc":
+		return "-flto=auto"
+	case lto == LTOThin:
+		return "-flto=thin"
+	}
+	return "-flto=full"
+}
+
+// supportsLTO returns true if a program can be built with link-time optimization using the given linker. This fails
+// for example with clang if the linker has no plugin for LLVM.
+func (caps *compilerCapabilities) supportsLTO(lto LTOType, linker LinkerType) bool {
+	key := "lto " + caps.ltoFlag(lto)
+	args := []string{caps.ltoFlag(lto), "-x", "c", "-", "-o", os.DevNull}
+	if linker != LinkerDefault {
+		key += " " + linker.String()
+		args = append(args, "-fuse-ld="+linker.String())
+	}
+	return caps.probe(key, caps.cc, args, "int main(void) { return 0; }\n")
+}
+
+// supportsSanitizers returns true if a program can be built with the given sanitizers, which also makes sure that
+// their runtime libraries are installed.
+func (caps *compilerCapabilities) supportsSanitizers(sanitizers []string, static bool) bool {
+	key := "sanitize " + strings.Join(sanitizers, ",")
+	args := []string{sanitizeFlag(sanitizers), "-x", "c", "-", "-o", os.DevNull}
+	if static {
+		key += " static"
+		args = append(args, "-static")
+	}
+	return caps.probe(key, caps.cc, args, "int main(void) { return 0; }\n")
+}
+
+// validateOptions returns an error if the libraries and tools that the options ask for can't be used.
+func (caps *compilerCapabilities) validateOptions(options *CompilerOptions) error {
+	if options.CPPStandard != CPPStandardLatest && slices.Contains(options.Languages, "c++") {
+		if caps.firstSupported("c++", stdFlags(cppStandardNames[options.CPPStandard])) == "" {
+			return fmt.Errorf("the compiler doesn't support C++%s", options.CPPStandard)
+		}
+	}
+	if options.CStandard != CStandardLatest && slices.Contains(options.Languages, "c") {
+		if caps.firstSupported("c", stdFlags(cStandardNames[options.CStandard])) == "" {
+			return fmt.Errorf("the compiler doesn't support C%s", options.CStandard)
+		}
+	}
+
+	if options.StdLib != StdLibDefault && slices.Contains(options.Languages, "c++") {
+		if !caps.supportsStdLib(options.StdLib.String(), options.Static) {
+			return fmt.Errorf("unable to build with the C++ standard library %s, as it's not installed or not supported by the compiler", options.StdLib)
+		}
+	}
+
+	if options.Linker != LinkerDefault {
+		if !caps.supportsLinker(options.Linker.String()) {
+			return fmt.Errorf("unable to link with %s, as it's not installed or not supported by the compiler", options.Linker)
+		}
+	}
+
+	if options.LTO != LTOOff {
+		if !caps.supportsLTO(options.LTO, options.Linker) {
+			return fmt.Errorf("unable to use %s link-time optimization, as the compiler or linker doesn't support it", options.LTO)
+		}
+	}
+
+	if len(options.Sanitize) > 0 {
+		if slices.Contains(options.Sanitize, "memory") && caps.family != "clang" {
+			return errors.New("the memory sanitizer is only supported by clang")
+		}
+		if !caps.supportsSanitizers(options.Sanitize, options.Static) {
+			return fmt.Errorf("unable to use the sanitizers %s, as the compiler doesn't support them or their runtime libraries are not installed", strings.Join(options.Sanitize, ","))
+		}
+	}
+
+	return nil
+}
+
+// probe runs the compiler with the given arguments and source code on its standard input, and returns true if it
+// succeeds. The result is remembered under the given key.
+func (caps *compilerCapabilities) probe(key string, compiler []string, args []string, source string) bool {
+	caps.mutex.Lock()
+	defer caps.mutex.Unlock()
+
+	if supported, ok := caps.flags[key]; ok {
+		return supported
+	}
+
+	supported := caps.runProbe(slices.Concat(compiler, caps.args, args), source)
+
+	caps.flags[key] = supported
+	caps.save()
+	return supported
+}
+
+// runProbe runs a command with the source code on its standard input, and returns true if it succeeds.
+func runProbe(command []string, source string) bool {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdin = strings.NewReader(source)
+	return cmd.Run() == nil
+}
+
+// firstSupported returns the first of the given flags that the compiler supports, or an empty string.
+func (caps *compilerCapabilities) firstSupported(language string, flags []string) string {
+	for _, flag := range flags {
+		if caps.supportsFlag(language, flag) {
+			return flag
+		}
+	}
+	return ""
+}
+
+// cppStandardFlag returns the -std= flag for a C++ standard. The latest standard is the newest one that the compiler
+// supports. A standard that the compiler doesn't support at all is passed anyway so that the compiler can explain,
+// although validateOptions rejects it before building.
+func (caps *compilerCapabilities) cppStandardFlag(std CPPStandardType) string {
+	standards := []CPPStandardType{std}
+	if std == CPPStandardLatest {
+		standards = cppStandardOrder
+	}
+	for _, standard := range standards {
+		if flag := caps.firstSupported("c++", stdFlags(cppStandardNames[standard])); flag != "" {
+			return flag
+		}
+	}
+	if std == CPPStandardLatest {
+		return ""
+	}
+	return "-std=" + cppStandardNames[std][0]
+}
+
+// cStandardFlag returns the -std= flag for a C standard, like cppStandardFlag does for C++.
+func (caps *compilerCapabilities) cStandardFlag(std CStandardType) string {
+	standards := []CStandardType{std}
+	if std == CStandardLatest {
+		standards = cStandardOrder
+	}
+	for _, standard := range standards {
+		if flag := caps.firstSupported("c", stdFlags(cStandardNames[standard])); flag != "" {
+			return flag
+		}
+	}
+	if std == CStandardLatest {
+		return ""
+	}
+	return "-std=" + cStandardNames[std][0]
+}
+
+// stdFlags turns names of a standard into -std= flags.
+func stdFlags(names []string) []string {
+	ret := make([]string, len(names))
+	for i, name := range names {
+		ret[i] = "-std=" + name
+	}
+	return ret
+}
+
+// capabilitiesCachePath returns the path of the file in which the capabilities of compilers are cached.
+func capabilitiesCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "qb", "capabilities.json"), nil
+}
+
+// loadCapabilitiesCache loads the cached capabilities of all compilers, keyed by compiler and flag.
+func loadCapabilitiesCache() (map[string]map[string]bool, error) {
+	path, err := capabilitiesCachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ret map[string]map[string]bool
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+// save writes the capabilities of the compiler to the cache. Failing to do so is not a problem, as we'll just probe
+// the compiler again next time.
+func (caps *compilerCapabilities) save() {
+	path, err := capabilitiesCachePath()
+	if err != nil {
+		return
+	}
+
+	cache, err := loadCapabilitiesCache()
+	if err != nil {
+		cache = make(map[string]map[string]bool)
+	}
+	cache[caps.key] = caps.flags
+
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return
+	}
+
+	// Write to a temporary file first, so that other instances of qb never see a partially written cache
+	os.MkdirAll(filepath.Dir(path), 0777)
+	file, err := os.CreateTemp(filepath.Dir(path), "capabilities-*.json")
+	if err != nil {
+		return
+	}
+	_, err = file.Write(data)
+	file.Close()
+	if err != nil {
+		os.Remove(file.Name())
+		return
+	}
+	os.Rename(file.Name(), path)
+}
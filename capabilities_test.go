@@ -0,0 +1,178 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// probeOptions are the options that every probe uses.
+var probeOptions = []string{"-x", "-", "-o", "-fsyntax-only"}
+
+// fakeCapabilities returns the capabilities of a compiler of the given family that only accepts the given options.
+// A probe succeeds if all of its options are accepted, apart from those that every probe uses. The cache is written
+// to a temporary directory.
+func fakeCapabilities(t *testing.T, family string, accepted ...string) *compilerCapabilities {
+	cacheDir := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cacheDir)
+	t.Setenv("HOME", cacheDir)
+	t.Setenv("LocalAppData", cacheDir)
+
+	return &compilerCapabilities{
+		family: family,
+		cc:     []string{family},
+		cxx:    []string{family + "++"},
+		flags:  make(map[string]bool),
+
+		runProbe: func(command []string, source string) bool {
+			for _, arg := range command[1:] {
+				if strings.HasPrefix(arg, "-") && !slices.Contains(probeOptions, arg) && !slices.Contains(accepted, arg) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+func TestCPPStandardFlag(t *testing.T) {
+	tests := []struct {
+		accepted []string
+		std      CPPStandardType
+		want     string
+	}{
+		{[]string{"-std=c++23", "-std=c++2b", "-std=c++20"}, CPPStandardLatest, "-std=c++23"},
+		{[]string{"-std=c++2b", "-std=c++20"}, CPPStandardLatest, "-std=c++2b"},
+		{[]string{"-std=c++2b", "-std=c++20"}, CPPStandard23, "-std=c++2b"},
+		{[]string{"-std=c++2b", "-std=c++20"}, CPPStandard20, "-std=c++20"},
+		{[]string{"-std=c++17"}, CPPStandard20, "-std=c++20"},
+		{nil, CPPStandardLatest, ""},
+	}
+
+	for _, test := range tests {
+		caps := fakeCapabilities(t, "gcc", test.accepted...)
+		if got := caps.cppStandardFlag(test.std); got != test.want {
+			t.Errorf("cppStandardFlag(%s) accepting %q = %q, want %q", test.std, test.accepted, got, test.want)
+		}
+	}
+}
+
+func TestCStandardFlag(t *testing.T) {
+	tests := []struct {
+		accepted []string
+		std      CStandardType
+		want     string
+	}{
+		{[]string{"-std=c23", "-std=c2x", "-std=c17"}, CStandardLatest, "-std=c23"},
+		{[]string{"-std=c2x", "-std=c17"}, CStandardLatest, "-std=c2x"},
+		{[]string{"-std=c17", "-std=c11"}, CStandardLatest, "-std=c17"},
+		{[]string{"-std=c18"}, CStandard17, "-std=c18"},
+		{[]string{"-std=c17"}, CStandard23, "-std=c23"},
+		{nil, CStandardLatest, ""},
+	}
+
+	for _, test := range tests {
+		caps := fakeCapabilities(t, "gcc", test.accepted...)
+		if got := caps.cStandardFlag(test.std); got != test.want {
+			t.Errorf("cStandardFlag(%s) accepting %q = %q, want %q", test.std, test.accepted, got, test.want)
+		}
+	}
+}
+
+func TestValidateOptionsStandards(t *testing.T) {
+	tests := []struct {
+		name    string
+		options CompilerOptions
+		ok      bool
+	}{
+		{"latest standards", CompilerOptions{Languages: []string{"c", "c++"}}, true},
+		{"supported C++ standard", CompilerOptions{CPPStandard: CPPStandard20, Languages: []string{"c++"}}, true},
+		{"unsupported C++ standard", CompilerOptions{CPPStandard: CPPStandard23, Languages: []string{"c++"}}, false},
+		{"unsupported C++ standard without C++ files", CompilerOptions{CPPStandard: CPPStandard23, Languages: []string{"c"}}, true},
+		{"supported C standard", CompilerOptions{CStandard: CStandard17, Languages: []string{"c"}}, true},
+		{"unsupported C standard", CompilerOptions{CStandard: CStandard23, Languages: []string{"c"}}, false},
+		{"unsupported C standard without C files", CompilerOptions{CStandard: CStandard23, Languages: []string{"c++"}}, true},
+	}
+
+	for _, test := range tests {
+		caps := fakeCapabilities(t, "gcc", "-std=c++20", "-std=c17")
+		err := caps.validateOptions(&test.options)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s: validateOptions() = %v, want ok %t", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestValidateOptionsStdLib(t *testing.T) {
+	tests := []struct {
+		name     string
+		family   string
+		accepted []string
+		options  CompilerOptions
+		ok       bool
+	}{
+		{"default library", "gcc", nil, CompilerOptions{Languages: []string{"c++"}}, true},
+		{"libc++ with gcc", "gcc", nil, CompilerOptions{StdLib: StdLibLibCPP, Languages: []string{"c++"}}, false},
+		{"libc++ with clang", "clang", []string{"-stdlib=libc++"}, CompilerOptions{StdLib: StdLibLibCPP, Languages: []string{"c++"}}, true},
+		{"libc++ without C++ files", "gcc", nil, CompilerOptions{StdLib: StdLibLibCPP, Languages: []string{"c"}}, true},
+		{"static libc++ without the static library", "clang", []string{"-stdlib=libc++"}, CompilerOptions{StdLib: StdLibLibCPP, Static: true, Languages: []string{"c++"}}, false},
+		{"static libc++", "clang", []string{"-stdlib=libc++", "-static", "-lc++abi"}, CompilerOptions{StdLib: StdLibLibCPP, Static: true, Languages: []string{"c++"}}, true},
+		{"libstdc++ with clang", "clang", []string{"-stdlib=libstdc++"}, CompilerOptions{StdLib: StdLibLibStdCPP, Languages: []string{"c++"}}, true},
+	}
+
+	for _, test := range tests {
+		caps := fakeCapabilities(t, test.family, test.accepted...)
+		err := caps.validateOptions(&test.options)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s: validateOptions() = %v, want ok %t", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestValidateOptionsLinker(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepted []string
+		linker   LinkerType
+		ok       bool
+	}{
+		{"default linker", nil, LinkerDefault, true},
+		{"installed linker", []string{"-fuse-ld=lld"}, LinkerLLD, true},
+		{"missing linker", []string{"-fuse-ld=lld"}, LinkerMold, false},
+		{"gold", []string{"-fuse-ld=gold", "-fuse-ld=bfd"}, LinkerGold, true},
+	}
+
+	for _, test := range tests {
+		caps := fakeCapabilities(t, "gcc", test.accepted...)
+		err := caps.validateOptions(&CompilerOptions{Linker: test.linker, Languages: []string{"c"}})
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s: validateOptions() = %v, want ok %t", test.name, err, test.ok)
+		}
+	}
+}
+
+func TestValidateOptionsLTO(t *testing.T) {
+	tests := []struct {
+		name     string
+		family   string
+		accepted []string
+		lto      LTOType
+		linker   LinkerType
+		ok       bool
+	}{
+		{"off", "clang", nil, LTOOff, LinkerDefault, true},
+		{"gcc uses its own mode for thin", "gcc", []string{"-flto=auto"}, LTOThin, LinkerDefault, true},
+		{"thin with clang", "clang", []string{"-flto=thin"}, LTOThin, LinkerDefault, true},
+		{"full without support", "clang", []string{"-flto=thin"}, LTOFull, LinkerDefault, false},
+		{"with a linker that supports it", "clang", []string{"-flto=thin", "-fuse-ld=lld"}, LTOThin, LinkerLLD, true},
+		{"with a linker that doesn't support it", "clang", []string{"-fuse-ld=bfd"}, LTOThin, LinkerBFD, false},
+	}
+
+	for _, test := range tests {
+		caps := fakeCapabilities(t, test.family, test.accepted...)
+		err := caps.validateOptions(&CompilerOptions{LTO: test.lto, Linker: test.linker, Languages: []string{"c"}})
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("%s: validateOptions() = %v, want ok %t", test.name, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+
+	"github.com/codecat/go-libs/log"
+	"github.com/spf13/pflag"
+)
+
+// Command is a subcommand of qb, such as "build" or "run".
+type Command struct {
+	// Name is the name of the command, as passed on the command line.
+	Name string
+
+	// Args describes the arguments of the command in its usage line.
+	Args string
+
+	// Summary is a short description of the command, shown in the list of commands.
+	Summary string
+
+	// Description explains what the command does.
+	Description string
+
+	// Flags are the command line flags that only apply to this command.
+	Flags []string
+
+	// Run runs the command with the arguments that follow it, and returns the exit code.
+	Run func(args []string) int
+}
+
+// commands contains all available commands. The first command is the default.
+var commands []*Command
+
+func init() {
+	commands = []*Command{
+		{
+			Name:        "build",
+			Summary:     "build the project (default)",
+			Description: "Builds the project. This is the default command if no command is given.",
+			Run:         commandBuild,
+		},
+		{
+			Name:        "run",
+			Summary:     "build and run the project",
+			Args:        "[-- args...]",
+			Description: "Builds the project and runs the resulting executable. Any arguments after -- are passed to the executable, and qb exits with the exit code of the executable.",
+			Run:         commandRun,
+		},
+		{
+			Name:        "coverage",
+			Summary:     "build and run the project with code coverage",
+			Args:        "[-- args...]",
+			Description: "Builds the project with coverage instrumentation, runs the resulting executable, and reports which lines and functions were executed. A summary is printed, and an LCOV file and HTML report are written to the coverage directory in the output directory. Any arguments after -- are passed to the executable. This requires gcc with gcov, or clang with llvm-profdata and llvm-cov.",
+			Run:         commandCoverage,
+		},
+		{
+			Name:        "pgo",
+			Summary:     "build with profile-guided optimization",
+			Args:        "<generate|use|off>",
+			Description: "Builds the project with profile-guided optimization. \"qb pgo generate\" makes an instrumented build, which collects profiles in the .qb directory each time it's run, for example with \"qb run\". \"qb pgo use\" then merges the profiles and rebuilds the project optimized for them. Later builds keep using the profiles until \"qb pgo off\" removes them. This requires gcc, or clang with llvm-profdata, on Linux.",
+			Run:         commandPGO,
+		},
+		{
+			Name:        "clean",
+			Summary:     "remove the build output",
+			Description: "Cleans all output files that qb could generate.",
+			Run:         commandClean,
+		},
+		{
+			Name:        "config",
+			Summary:     "print the effective configuration",
+			Description: "Prints the effective configuration, including where each value came from.",
+			Flags:       []string{"json"},
+			Run:         commandConfig,
+		},
+		{
+			Name:        "doctor",
+			Summary:     "check whether the toolchain works",
+			Description: "Reports the compilers and tools that qb can find, the details of the toolchain that would be used, and builds a tiny test program in each language and output type to check whether the toolchain works. qb exits with a non-zero exit code if any problems were found.",
+			Run:         commandDoctor,
+		},
+		{
+			Name:        "check-hardening",
+			Summary:     "check whether the binary is hardened",
+			Description: "Inspects the ELF binary that the project builds to check whether it's hardened against exploits, as with --harden: position independent, full RELRO, stack protector, fortified C library functions, non-executable stack, and Intel CET on x86. qb exits with a non-zero exit code if any check fails. The project has to be built first.",
+			Run:         commandCheckHardening,
+		},
+		{
+			Name:        "help",
+			Summary:     "show help for a command",
+			Args:        "[command]",
+			Description: "Shows help for qb or for a specific command.",
+			Run:         commandHelp,
+		},
+	}
+}
+
+// findCommand returns the command with the given name, or nil if there is no such command.
+func findCommand(name string) *Command {
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return cmd
+		}
+	}
+	return nil
+}
+
+// parseCommand returns the command given on the command line and the arguments that follow it. Only arguments
+// before "--" are considered as the command name, so that arguments meant for the executable are never mistaken
+// for a command.
+func parseCommand() (string, []string) {
+	args := pflag.Args()
+	if len(args) == 0 || pflag.CommandLine.ArgsLenAtDash() == 0 {
+		return commands[0].Name, args
+	}
+	return args[0], args[1:]
+}
+
+// commandNames returns the names of all commands, including plugins.
+func commandNames() []string {
+	ret := make([]string, len(commands))
+	for i, cmd := range commands {
+		ret[i] = cmd.Name
+	}
+	return append(ret, pluginNames()...)
+}
+
+// noArguments returns false and reports an error if any arguments were given to a command that takes none.
+func noArguments(cmd string, args []string) bool {
+	if len(args) == 0 {
+		return true
+	}
+	log.Fatal("Unexpected argument for %s: %s", cmd, strings.Join(args, " "))
+	return false
+}
+
+func commandBuild(args []string) int {
+	if !noArguments("build", args) {
+		return 1
+	}
+
+	contexts, configs := loadProject()
+	prepareBuild(contexts, configs, true)
+
+	if _, ok := buildAll(contexts); !ok {
+		return 1
+	}
+	return 0
+}
+
+func commandRun(args []string) int {
+	contexts, configs := loadProject()
+	if contexts[0].Type != LinkExe {
+		log.Fatal("Only executables can be run, but the project type is %s", contexts[0].Type)
+		return 1
+	}
+
+	prepareBuild(contexts, configs, true)
+
+	results, ok := buildAll(contexts)
+	if !ok {
+		return 1
+	}
+
+	// Run the binary of the first configuration. We have to use the absolute path here to make this work on Linux
+	// and MacOS.
+	absOutPath, _ := filepath.Abs(results[0].outPath)
+	cmd := exec.Command(absOutPath)
+	cmd.Args = slices.Concat([]string{absOutPath}, args)
+	return runProgram(cmd)
+}
+
+// runProgram runs a program attached to our standard input and output, and returns its exit code.
+func runProgram(cmd *exec.Cmd) int {
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	// Interrupts are meant for the program, so we should not exit before it does
+	signal.Ignore(os.Interrupt)
+	defer signal.Reset(os.Interrupt)
+
+	err := cmd.Run()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitCode(exitErr.ProcessState)
+		}
+		log.Fatal("Unable to run %s: %s", cmd.Path, err.Error())
+		return 1
+	}
+	return 0
+}
+
+// exitCode returns the exit code of a program that has exited. Like in a shell, a program that was killed by a
+// signal exits with 128 plus the number of the signal.
+func exitCode(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	if code := state.ExitCode(); code >= 0 {
+		return code
+	}
+	return 1
+}
+
+func commandCoverage(args []string) int {
+	contexts, configs := loadProject()
+	if contexts[0].Type != LinkExe {
+		log.Fatal("Only executables can be run for coverage, but the project type is %s", contexts[0].Type)
+		return 1
+	}
+
+	ctx := contexts[0]
+	coverage, ok := ctx.Compiler.(CoverageCompiler)
+	if !ok {
+		log.Fatal("The %s toolset doesn't support coverage", ctx.Compiler.Toolset())
+		return 1
+	}
+	if toolchain.Target != "" {
+		log.Fatal("Coverage can't be collected when cross-compiling, as the executable has to run on this system")
+		return 1
+	}
+
+	prepareBuild(contexts, configs, true)
+
+	// Only the first configuration is built, and its object files have to stay around until the coverage data that
+	// is written next to them has been collected
+	ctx.CompilerOptions.Coverage = true
+	objectPath, err := os.MkdirTemp("", "qb_coverage_")
+	if err != nil {
+		log.Fatal("Unable to create a temporary directory: %s", err.Error())
+		return 1
+	}
+	defer os.RemoveAll(objectPath)
+
+	results, ok := buildAllIn(contexts[:1], objectPath)
+	if !ok {
+		return 1
+	}
+
+	absOutPath, _ := filepath.Abs(results[0].outPath)
+	cmd := exec.Command(absOutPath)
+	cmd.Args = slices.Concat([]string{absOutPath}, args)
+	cmd.Env = append(os.Environ(), coverage.CoverageEnv(ctx.ObjectPath)...)
+	exitCode := runProgram(cmd)
+
+	// A failing program still tells us what it covered, so we report it anyway
+	files, err := coverage.Coverage(ctx.ObjectPath, absOutPath)
+	if err != nil {
+		log.Fatal("Unable to collect coverage: %s", err.Error())
+		return 1
+	}
+	printCoverage(files)
+
+	reportPath := filepath.Join(ctx.OutPath, "coverage")
+	err = os.MkdirAll(reportPath, 0777)
+	if err == nil {
+		err = writeLcov(filepath.Join(reportPath, "lcov.info"), files)
+	}
+	if err == nil {
+		err = writeCoverageHTML(filepath.Join(reportPath, "index.html"), files)
+	}
+	if err != nil {
+		log.Fatal("Unable to write the coverage report: %s", err.Error())
+		return 1
+	}
+	log.Info("📄 %s", filepath.Join(reportPath, "index.html"))
+
+	return exitCode
+}
+
+func commandClean(args []string) int {
+	if !noArguments("clean", args) {
+		return 1
+	}
+
+	contexts, _ := loadProject()
+	for _, ctx := range contexts {
+		ctx.Compiler.Clean(filepath.Join(ctx.OutPath, ctx.Name))
+	}
+	return 0
+}
+
+func commandConfig(args []string) int {
+	if !noArguments("config", args) {
+		return 1
+	}
+
+	contexts, configs := loadProject()
+	prepareBuild(contexts, configs, false)
+
+	asJSON, _ := pflag.CommandLine.GetBool("json")
+	printConfig(contexts, configs, asJSON)
+	return 0
+}
+
+func commandHelp(args []string) int {
+	if len(args) == 0 {
+		printUsage()
+		return 0
+	}
+
+	cmd := findCommand(args[0])
+	if cmd == nil {
+		log.Fatal("Unknown command %s%s", args[0], didYouMean(args[0], commandNames()))
+		return 1
+	}
+	printCommandUsage(cmd)
+	return 0
+}
+
+// printUsage prints the general help of qb.
+func printUsage() {
+	fmt.Println("Usage: qb [command] [options]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	width := 0
+	for _, cmd := range commands {
+		width = max(width, len(cmd.Name))
+	}
+	for _, cmd := range commands {
+		fmt.Printf("  %-*s %s\n", width, cmd.Name, cmd.Summary)
+	}
+
+	if plugins := pluginNames(); len(plugins) > 0 {
+		fmt.Println()
+		fmt.Println("Plugins:")
+		for _, name := range plugins {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Print(flagUsages(nil))
+	fmt.Println()
+	fmt.Println("Use \"qb help <command>\" for more information about a command.")
+}
+
+// printCommandUsage prints the help of a single command.
+func printCommandUsage(cmd *Command) {
+	fmt.Println(strings.TrimSpace("Usage: qb " + cmd.Name + " [options] " + cmd.Args))
+	fmt.Println()
+	fmt.Println(cmd.Description)
+
+	if len(cmd.Flags) > 0 {
+		fmt.Println()
+		fmt.Printf("Options for %s:\n", cmd.Name)
+		fmt.Print(flagUsages(cmd.Flags))
+	}
+
+	fmt.Println()
+	fmt.Println("Options:")
+	fmt.Print(flagUsages(nil))
+}
+
+// flagUsages returns the usage of the given command flags, or of all options if names is nil.
+func flagUsages(names []string) string {
+	flags := pflag.NewFlagSet("qb", pflag.ContinueOnError)
+	pflag.VisitAll(func(flag *pflag.Flag) {
+		if names == nil && !commandFlags[flag.Name] || slices.Contains(names, flag.Name) {
+			flags.AddFlag(flag)
+		}
+	})
+	return flags.FlagUsages()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		wantName string
+		wantArgs []string
+	}{
+		{[]string{}, "build", []string{}},
+		{[]string{"run"}, "run", []string{}},
+		{[]string{"run", "foo"}, "run", []string{"foo"}},
+		{[]string{"--verbose", "run"}, "run", []string{}},
+		{[]string{"run", "--", "foo", "--verbose"}, "run", []string{"foo", "--verbose"}},
+		{[]string{"run", "--verbose", "--", "foo"}, "run", []string{"foo"}},
+		{[]string{"--", "run"}, "build", []string{"run"}},
+		{[]string{"--"}, "build", []string{}},
+	}
+
+	for _, test := range tests {
+		parseFlags(t, test.args...)
+
+		name, args := parseCommand()
+		if name != test.wantName || !reflect.DeepEqual(args, test.wantArgs) {
+			t.Errorf("parseCommand() with %q = %q, %q, want %q, %q", test.args, name, args, test.wantName, test.wantArgs)
+		}
+	}
+}
+
+func TestRunProgramExitCode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals can't be sent with sh on Windows")
+	}
+
+	tests := []struct {
+		script string
+		want   int
+	}{
+		{"exit 0", 0},
+		{"exit 3", 3},
+		{"kill -TERM $$", 128 + 15},
+		{"kill -KILL $$", 128 + 9},
+	}
+
+	for _, test := range tests {
+		if got := runProgram(exec.Command("sh", "-c", test.script)); got != test.want {
+			t.Errorf("runProgram(%q) = %d, want %d", test.script, got, test.want)
+		}
+	}
+}
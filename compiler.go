@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"os"
 	"path"
 	"path/filepath"
@@ -8,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/codecat/go-libs/log"
+	"github.com/spf13/viper"
 )
 
 // LinkType specifies the output build type.
@@ -24,11 +26,108 @@ const (
 	LinkLib
 )
 
+func (t LinkType) String() string {
+	switch t {
+	case LinkExe:
+		return "exe"
+	case LinkDll:
+		return "dll"
+	case LinkLib:
+		return "lib"
+	}
+	return "unknown"
+}
+
+func (t LinkType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 // Compiler contains information about the compiler.
 type Compiler interface {
 	Compile(path, objDir string, options *CompilerOptions) error
 	Link(objDir, outPath string, outType LinkType, options *CompilerOptions) (string, error)
 	Clean(name string)
+
+	// OutputFile returns the path of the file that Link produces for the given output path and type, which is the
+	// output path with the appropriate suffix added.
+	OutputFile(outPath string, outType LinkType) string
+
+	// Toolset returns the name of the toolset, such as "gcc", "clang", or "msvc".
+	Toolset() string
+
+	// Version returns the version of the compiler, or an empty string if it's unknown.
+	Version() string
+
+	// Details returns details about the toolchain, like the commands it runs and its default search paths.
+	Details() []toolchainDetail
+
+	// ValidateOptions returns an error if the toolchain can't build with the given options, for example because a
+	// library that the options ask for is not installed.
+	ValidateOptions(options *CompilerOptions) error
+
+	// CompileHeader precompiles a header for the given language, either "c" or "c++", into the directory of
+	// options.PCHDir, so that it can be included in every source file of that language.
+	CompileHeader(header, language string, options *CompilerOptions) error
+}
+
+// ResourceCompiler is implemented by compilers that can compile Windows resource scripts (.rc files) into object
+// files that are linked into the output.
+type ResourceCompiler interface {
+	CompileResource(path, objDir string, options *CompilerOptions) error
+}
+
+// CoverageCompiler is implemented by compilers that can build with coverage instrumentation, and collect the
+// coverage data that the instrumented executable leaves behind when it's run.
+type CoverageCompiler interface {
+	// CoverageEnv returns the environment variables that make the executable write its coverage data to the object
+	// directory.
+	CoverageEnv(objDir string) []string
+
+	// Coverage collects the coverage data of the executable from the object directory.
+	Coverage(objDir, exePath string) ([]*coverageFile, error)
+}
+
+// PGOCompiler is implemented by compilers that support profile-guided optimization.
+type PGOCompiler interface {
+	// MergeProfiles prepares the profiles that an instrumented build collected in the directory for use.
+	MergeProfiles(profilePath string) error
+}
+
+// ToolchainOptions contains the options that decide which compiler is used. These apply to all configurations.
+type ToolchainOptions struct {
+	// Toolset is the toolset that was asked for, such as "clang", "gcc-13", "mingw", or the path to a compiler. If
+	// empty, the default toolset of the host is used.
+	Toolset string
+
+	// Target is the target triple to build for, such as "aarch64-linux-gnu". If empty, we build for the host.
+	Target string
+
+	// Sysroot is the directory that contains the headers and libraries of the target system.
+	Sysroot string
+}
+
+// newToolchainOptions reads the toolchain options from the configuration.
+func newToolchainOptions() ToolchainOptions {
+	ret := ToolchainOptions{
+		Toolset: viper.GetString("toolset"),
+		Target:  viper.GetString("target"),
+		Sysroot: viper.GetString("sysroot"),
+	}
+
+	// MinGW always cross-compiles, so it needs a target even if none was given
+	if ret.Toolset == "mingw" && ret.Target == "" {
+		ret.Target = defaultMingwTarget
+	}
+	return ret
+}
+
+// findCompiler returns the compiler for the toolchain options. Toolsets that work on any host are handled here, and
+// everything else is left to the compiler of the host.
+func findCompiler(toolchain ToolchainOptions) (Compiler, error) {
+	if isMingw(toolchain) {
+		return getMingwCompiler(toolchain)
+	}
+	return getCompiler(toolchain)
 }
 
 // ExceptionType is the way that a compiler's runtime might handle exceptions.
@@ -45,6 +144,22 @@ const (
 	ExceptionsMinimal
 )
 
+func (t ExceptionType) String() string {
+	switch t {
+	case ExceptionsStandard:
+		return "std"
+	case ExceptionsAll:
+		return "all"
+	case ExceptionsMinimal:
+		return "min"
+	}
+	return "unknown"
+}
+
+func (t ExceptionType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 // OptimizeType defines the compiler optimization type.
 type OptimizeType int
 
@@ -62,6 +177,24 @@ const (
 	OptimizeSpeed
 )
 
+func (t OptimizeType) String() string {
+	switch t {
+	case OptimizeDefault:
+		return "default"
+	case OptimizeNone:
+		return "none"
+	case OptimizeSize:
+		return "size"
+	case OptimizeSpeed:
+		return "speed"
+	}
+	return "unknown"
+}
+
+func (t OptimizeType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 // CPPStandardType defines the C++ standard to use.
 type CPPStandardType int
 
@@ -69,6 +202,12 @@ const (
 	// CPPStandardLatest uses the latest C++ standard available to the compiler.
 	CPPStandardLatest CPPStandardType = iota
 
+	// CPPStandard26 uses the C++26 standard.
+	CPPStandard26
+
+	// CPPStandard23 uses the C++23 standard.
+	CPPStandard23
+
 	// CPPStandard20 uses the C++20 standard.
 	CPPStandard20
 
@@ -79,6 +218,28 @@ const (
 	CPPStandard14
 )
 
+func (t CPPStandardType) String() string {
+	switch t {
+	case CPPStandardLatest:
+		return "latest"
+	case CPPStandard26:
+		return "26"
+	case CPPStandard23:
+		return "23"
+	case CPPStandard20:
+		return "20"
+	case CPPStandard17:
+		return "17"
+	case CPPStandard14:
+		return "14"
+	}
+	return "unknown"
+}
+
+func (t CPPStandardType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 // CStandardType defines the C standard to use.
 type CStandardType int
 
@@ -86,13 +247,194 @@ const (
 	// CStandardLatest uses the latest C standard available to the compiler.
 	CStandardLatest CStandardType = iota
 
-	// CStandard11 uses the C17 standard.
+	// CStandard23 uses the C23 standard.
+	CStandard23
+
+	// CStandard17 uses the C17 standard.
 	CStandard17
 
 	// CStandard11 uses the C11 standard.
 	CStandard11
 )
 
+func (t CStandardType) String() string {
+	switch t {
+	case CStandardLatest:
+		return "latest"
+	case CStandard23:
+		return "23"
+	case CStandard17:
+		return "17"
+	case CStandard11:
+		return "11"
+	}
+	return "unknown"
+}
+
+func (t CStandardType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// StdLibType is the C++ standard library to use.
+type StdLibType int
+
+const (
+	// StdLibDefault uses the default C++ standard library of the compiler.
+	StdLibDefault StdLibType = iota
+
+	// StdLibLibCPP uses LLVM's libc++.
+	StdLibLibCPP
+
+	// StdLibLibStdCPP uses GNU's libstdc++.
+	StdLibLibStdCPP
+)
+
+func (t StdLibType) String() string {
+	switch t {
+	case StdLibDefault:
+		return "default"
+	case StdLibLibCPP:
+		return "libc++"
+	case StdLibLibStdCPP:
+		return "libstdc++"
+	}
+	return "unknown"
+}
+
+func (t StdLibType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// LinkerType is the linker to use.
+type LinkerType int
+
+const (
+	// LinkerDefault uses the default linker of the compiler.
+	LinkerDefault LinkerType = iota
+
+	// LinkerLLD uses LLVM's lld, or lld-link with MSVC.
+	LinkerLLD
+
+	// LinkerMold uses mold.
+	LinkerMold
+
+	// LinkerGold uses GNU gold.
+	LinkerGold
+
+	// LinkerBFD uses the GNU linker, ld.bfd.
+	LinkerBFD
+)
+
+func (t LinkerType) String() string {
+	switch t {
+	case LinkerDefault:
+		return "default"
+	case LinkerLLD:
+		return "lld"
+	case LinkerMold:
+		return "mold"
+	case LinkerGold:
+		return "gold"
+	case LinkerBFD:
+		return "bfd"
+	}
+	return "unknown"
+}
+
+func (t LinkerType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// LTOType is the mode of link-time optimization.
+type LTOType int
+
+const (
+	// LTOOff disables link-time optimization.
+	LTOOff LTOType = iota
+
+	// LTOThin uses a faster, parallel form of link-time optimization, like ThinLTO in clang.
+	LTOThin
+
+	// LTOFull optimizes the whole program at once.
+	LTOFull
+)
+
+func (t LTOType) String() string {
+	switch t {
+	case LTOOff:
+		return "off"
+	case LTOThin:
+		return "thin"
+	case LTOFull:
+		return "full"
+	}
+	return "unknown"
+}
+
+func (t LTOType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// DebugInfoType is where the debug information of a binary goes.
+type DebugInfoType int
+
+const (
+	// DebugInfoEmbedded keeps the debug information of debug builds in the binary.
+	DebugInfoEmbedded DebugInfoType = iota
+
+	// DebugInfoSplit always produces debug information, and moves it out of the binary into a separate file.
+	DebugInfoSplit
+
+	// DebugInfoNone produces no debug information, and strips the binary.
+	DebugInfoNone
+)
+
+func (t DebugInfoType) String() string {
+	switch t {
+	case DebugInfoEmbedded:
+		return "embedded"
+	case DebugInfoSplit:
+		return "split"
+	case DebugInfoNone:
+		return "none"
+	}
+	return "unknown"
+}
+
+func (t DebugInfoType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// PGOType is the stage of profile-guided optimization.
+type PGOType int
+
+const (
+	// PGOOff disables profile-guided optimization.
+	PGOOff PGOType = iota
+
+	// PGOGenerate builds with instrumentation that collects profiles when the program is run.
+	PGOGenerate
+
+	// PGOUse optimizes using the collected profiles.
+	PGOUse
+)
+
+func (t PGOType) String() string {
+	switch t {
+	case PGOOff:
+		return "off"
+	case PGOGenerate:
+		return "generate"
+	case PGOUse:
+		return "use"
+	}
+	return "unknown"
+}
+
+func (t PGOType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
 // CompilerOptions contains options used for compiling and linking.
 type CompilerOptions struct {
 	// Static sets whether to build a completely-static binary (eg. no dynamic link libraries are loaded from disk).
@@ -107,6 +449,15 @@ type CompilerOptions struct {
 	// Strict sets whether to be more strict on warnings.
 	Strict bool
 
+	// DebugInfo sets where debug information goes. SplitDWARF keeps most of it out of the object files, and
+	// CompressDebug compresses it.
+	DebugInfo     DebugInfoType
+	SplitDWARF    bool
+	CompressDebug bool
+
+	// Harden sets whether to harden the binary against exploits, with protections like PIE and full RELRO.
+	Harden bool
+
 	// Include paths and library links
 	IncludeDirectories []string
 	LinkDirectories    []string
@@ -126,49 +477,105 @@ type CompilerOptions struct {
 	Optimization OptimizeType
 	CPPStandard  CPPStandardType
 	CStandard    CStandardType
+	StdLib       StdLibType
+	Linker       LinkerType
+	LTO          LTOType
+
+	// Sanitize contains the sanitizers to build with, such as "address" or "undefined".
+	Sanitize []string
+
+	// Coverage sets whether to build with coverage instrumentation. This is only set by "qb coverage".
+	Coverage bool
+
+	// PGO is the stage of profile-guided optimization, and ProfilePath is the absolute path of the directory that
+	// contains the profiles. These are set by "qb pgo".
+	PGO         PGOType
+	ProfilePath string
+
+	// PCH is the path of the header to precompile and include in every source file of the languages in
+	// PCHLanguages. PCHDir is the directory in the object directory that contains the precompiled header, which is set
+	// once the header has been compiled.
+	PCH          string
+	PCHLanguages []string
+	PCHDir       string
+
+	// Languages contains the languages of the source files, either "c" or "c++". The C++ runtime is only linked if
+	// there are C++ sources.
+	Languages []string
+}
+
+// debugSymbols returns true if debug information should be produced. Debug builds have it unless it's not wanted at
+// all, and split debug information is always produced.
+func (options *CompilerOptions) debugSymbols() bool {
+	return options.DebugInfo == DebugInfoSplit || options.Debug && options.DebugInfo != DebugInfoNone
+}
+
+// checkSplitDWARF returns an error if the .dwo files of split DWARF would be lost. They're packaged into a .dwp file
+// when linking a binary, but a static library is only an archive of the object files, and the .dwo files are removed
+// along with the object files.
+func checkSplitDWARF(outType LinkType, options *CompilerOptions) error {
+	if options.SplitDWARF && outType == LinkLib {
+		return errors.New("split DWARF can't be used for static libraries, as their .dwo files would be lost")
+	}
+	return nil
 }
 
 // CompilerWorkerTask describes a task for the compiler worker
 type CompilerWorkerTask struct {
+	ctx       *Context
 	path      string
 	outputDir string
 }
 
-func compileWorker(ctx *Context, num int) {
-	for {
-		// Get a task
-		task, ok := <-ctx.CompilerWorkerChannel
-		if !ok {
-			break
-		}
+func compileWorker(tasks chan CompilerWorkerTask) {
+	for task := range tasks {
+		ctx := task.ctx
 
 		// Log the file we're currently compiling
 		fileForward := strings.Replace(task.path, "\\", "/", -1)
-		log.Info("%s", fileForward)
-
-		// Invoke the compiler
-		err := ctx.Compiler.Compile(task.path, task.outputDir, ctx.CompilerOptions)
+		log.Info("%s%s", ctx.logPrefix(), fileForward)
+
+		// Invoke the compiler, or the resource compiler for resource scripts
+		var err error
+		if resources, ok := ctx.Compiler.(ResourceCompiler); ok && filepath.Ext(task.path) == ".rc" {
+			err = resources.CompileResource(task.path, task.outputDir, ctx.CompilerOptions)
+		} else {
+			err = ctx.Compiler.Compile(task.path, task.outputDir, ctx.CompilerOptions)
+		}
 		if err != nil {
-			log.Error("Failed to compile %s!\n%s", fileForward, err.Error())
-			ctx.CompilerErrors++
+			log.Error("Failed to compile %s%s!\n%s", ctx.logPrefix(), fileForward, err.Error())
+			ctx.CompilerErrors.Add(1)
 		}
+
+		ctx.CompilerWorkerGroup.Done()
 	}
+}
 
-	ctx.CompilerWorkerFinished <- num
+// startCompilerWorkers starts the compiler worker routines and returns the channel to send tasks to. The workers
+// are shared between all configurations that are being built.
+func startCompilerWorkers() chan CompilerWorkerTask {
+	tasks := make(chan CompilerWorkerTask)
+	for i := 0; i < runtime.NumCPU(); i++ {
+		go compileWorker(tasks)
+	}
+	return tasks
 }
 
 func performCompilation(ctx *Context) {
-	// Prepare worker channels
-	ctx.CompilerWorkerChannel = make(chan CompilerWorkerTask)
-	ctx.CompilerWorkerFinished = make(chan int)
-
-	// Start compiler worker routines
-	numWorkers := runtime.NumCPU()
-	if len(ctx.SourceFiles) < numWorkers {
-		numWorkers = len(ctx.SourceFiles)
-	}
-	for i := 0; i < numWorkers; i++ {
-		go compileWorker(ctx, i)
+	// Precompile the header once for each of its languages, before any of the source files that include it
+	if ctx.CompilerOptions.PCH != "" {
+		ctx.CompilerOptions.PCHDir = filepath.Join(ctx.ObjectPath, "pch")
+		for _, language := range ctx.CompilerOptions.PCHLanguages {
+			header := strings.Replace(ctx.CompilerOptions.PCH, "\\", "/", -1)
+			log.Info("%s%s (%s)", ctx.logPrefix(), header, language)
+
+			err := ctx.Compiler.CompileHeader(ctx.CompilerOptions.PCH, language, ctx.CompilerOptions)
+			if err != nil {
+				log.Error("Failed to precompile %s%s!\n%s", ctx.logPrefix(), header, err.Error())
+				ctx.CompilerErrors.Add(1)
+				return
+			}
+		}
 	}
 
 	// Compile all the source files
@@ -180,24 +587,21 @@ func performCompilation(ctx *Context) {
 		err := os.MkdirAll(outputDir, 0777)
 		if err != nil {
 			log.Error("Unable to create output directory %s: %s", outputDir, err.Error())
-			ctx.CompilerErrors++
+			ctx.CompilerErrors.Add(1)
 			continue
 		}
 
 		// Send the task to an available worker
+		ctx.CompilerWorkerGroup.Add(1)
 		ctx.CompilerWorkerChannel <- CompilerWorkerTask{
+			ctx:       ctx,
 			path:      file,
 			outputDir: outputDir,
 		}
 	}
 
-	// Close the worker channel
-	close(ctx.CompilerWorkerChannel)
-
-	// Wait for all workers to finish compiling
-	for i := 0; i < numWorkers; i++ {
-		<-ctx.CompilerWorkerFinished
-	}
+	// Wait for all of our files to finish compiling
+	ctx.CompilerWorkerGroup.Wait()
 }
 
 func performLinking(ctx *Context) (string, error) {
@@ -4,25 +4,86 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/codecat/go-libs/log"
 )
 
 type darwinCompiler struct {
+	// toolset is the compiler family, which is usually "clang".
+	toolset string
+
+	// version is the version of the compiler.
+	version string
+
+	// cc and cxx are the commands that invoke the C and C++ compilers.
+	cc  []string
+	cxx []string
+
+	// caps contains what the compiler supports.
+	caps *compilerCapabilities
+
+	// target is the target triple, or empty when building for the host.
+	target string
+
+	// sysroot is the SDK to build against, if any.
+	sysroot string
+}
+
+// command creates a command that invokes a compiler with the given arguments.
+func (ci darwinCompiler) command(compiler []string, args []string) *exec.Cmd {
+	return exec.Command(compiler[0], slices.Concat(compiler[1:], args)...)
+}
+
+// targetArgs returns the arguments that make the compiler build for the target.
+func (ci darwinCompiler) targetArgs() []string {
+	args := make([]string, 0)
+	if ci.target != "" {
+		args = append(args, "--target="+ci.target)
+	}
+	if ci.sysroot != "" {
+		args = append(args, "-isysroot", ci.sysroot)
+	}
+	return args
 }
 
 func (ci darwinCompiler) Compile(path, objDir string, options *CompilerOptions) error {
 	fileext := filepath.Ext(path)
 	filename := strings.TrimSuffix(filepath.Base(path), fileext)
 
+	language := "c++"
+	if fileext == ".c" {
+		language = "c"
+	}
+
 	args := make([]string, 0)
 	args = append(args, "-c")
 	args = append(args, "-o", filepath.Join(objDir, filename+".o"))
-	args = append(args, "-std=c++17") // c++2a
+	args = append(args, gccPCHArgs(ci.caps.family, language, options)...)
+	return ci.compile(path, language, args, options)
+}
+
+func (ci darwinCompiler) CompileHeader(header, language string, options *CompilerOptions) error {
+	path, err := writePCHSource(options, language, filepath.Base(header))
+	if err != nil {
+		return err
+	}
+
+	args := make([]string, 0)
+	args = append(args, "-x", language+"-header")
+	args = append(args, "-o", gccPCHOutput(ci.caps.family, language, options))
+	return ci.compile(path, language, args, options)
+}
+
+// compile compiles a source file or header of the given language, either "c" or "c++". The arguments decide what it
+// is compiled into.
+func (ci darwinCompiler) compile(path, language string, args []string, options *CompilerOptions) error {
+	args = append(args, ci.targetArgs()...)
 
 	// Set warnings flags
 	if options.Strict {
@@ -32,7 +93,7 @@ func (ci darwinCompiler) Compile(path, objDir string, options *CompilerOptions)
 	}
 
 	// Set debug flag
-	if options.Debug {
+	if options.debugSymbols() {
 		args = append(args, "-g")
 	}
 
@@ -43,32 +104,40 @@ func (ci darwinCompiler) Compile(path, objDir string, options *CompilerOptions)
 		args = append(args, "-O3")
 	}
 
-	// Add C++ standard flag
-	if fileext != ".c" {
-		switch options.CPPStandard {
-		case CPPStandardLatest:
-			args = append(args, "-std=c++2b")
-		case CPPStandard20:
-			args = append(args, "-std=c++20")
-		case CPPStandard17:
-			args = append(args, "-std=c++17")
-		case CPPStandard14:
-			args = append(args, "-std=c++14")
+	// Add the language standard flag, as far as the compiler supports it
+	if language == "c" {
+		if flag := ci.caps.cStandardFlag(options.CStandard); flag != "" {
+			args = append(args, flag)
+		}
+	} else {
+		if flag := ci.caps.cppStandardFlag(options.CPPStandard); flag != "" {
+			args = append(args, flag)
 		}
 	}
 
-	// Add C standard flag
-	if fileext == ".c" {
-		switch options.CStandard {
-		case CStandardLatest:
-			args = append(args, "-std=c2x")
-		case CStandard17:
-			args = append(args, "-std=c17")
-		case CStandard11:
-			args = append(args, "-std=c11")
+	// Select the C++ standard library
+	if language != "c" && options.StdLib != StdLibDefault {
+		args = append(args, "-stdlib="+options.StdLib.String())
+	}
+
+	// Enable link-time optimization
+	if flag := ci.caps.ltoFlag(options.LTO); flag != "" {
+		args = append(args, flag)
+	}
+
+	// Add sanitizers, which need frame pointers and debug information for useful reports
+	if flag := sanitizeFlag(options.Sanitize); flag != "" {
+		args = append(args, flag, "-fno-omit-frame-pointer")
+		if !options.debugSymbols() {
+			args = append(args, "-g")
 		}
 	}
 
+	// Add coverage instrumentation
+	if options.Coverage {
+		args = append(args, coverageFlags(ci.caps.family)...)
+	}
+
 	// Add include directories
 	for _, dir := range options.IncludeDirectories {
 		args = append(args, "-I"+dir)
@@ -83,18 +152,22 @@ func (ci darwinCompiler) Compile(path, objDir string, options *CompilerOptions)
 	args = append(args, options.CompilerFlagsCXX...)
 
 	// Add additional compiler flags for C++
-	if fileext != ".c" {
+	if language != "c" {
 		args = append(args, options.CompilerFlagsCPP...)
 	}
 
 	// Add additional compiler flags for C
-	if fileext == ".c" {
+	if language == "c" {
 		args = append(args, options.CompilerFlagsC...)
 	}
 
 	args = append(args, path)
 
-	cmd := exec.Command("clang", args...)
+	compiler := ci.cxx
+	if language == "c" {
+		compiler = ci.cc
+	}
+	cmd := ci.command(compiler, args)
 
 	if options.Verbose {
 		log.Trace("%s", strings.Join(cmd.Args, " "))
@@ -111,16 +184,19 @@ func (ci darwinCompiler) Compile(path, objDir string, options *CompilerOptions)
 func (ci darwinCompiler) Link(objDir, outPath string, outType LinkType, options *CompilerOptions) (string, error) {
 	args := make([]string, 0)
 
-	exeName := "clang"
+	// Link with the C++ compiler if there are C++ sources, so that it adds the C++ standard library for us
+	cpp := slices.Contains(options.Languages, "c++")
+	linker := ci.cc
+	if cpp {
+		linker = ci.cxx
+	}
+	outPath = ci.OutputFile(outPath, outType)
 
 	switch outType {
-	case LinkExe:
 	case LinkDll:
-		outPath += ".dylib"
 		args = append(args, "-dynamiclib")
 	case LinkLib:
-		exeName = "ar"
-		outPath += ".a"
+		linker = []string{"ar"}
 	}
 
 	if outType == LinkLib {
@@ -132,6 +208,37 @@ func (ci darwinCompiler) Link(objDir, outPath string, outType LinkType, options
 
 	} else {
 		args = append(args, "-o", outPath)
+		args = append(args, ci.targetArgs()...)
+
+		// Strip the binary if it shouldn't have any debug information
+		if options.DebugInfo == DebugInfoNone {
+			args = append(args, "-Wl,-S")
+		}
+
+		// Link-time optimization has to be enabled when linking as well
+		if flag := ci.caps.ltoFlag(options.LTO); flag != "" {
+			args = append(args, flag)
+		}
+
+		// The sanitizers need their runtime libraries
+		if flag := sanitizeFlag(options.Sanitize); flag != "" {
+			args = append(args, flag)
+		}
+
+		// Link the coverage runtime
+		if options.Coverage {
+			args = append(args, coverageFlags(ci.caps.family)...)
+		}
+
+		// Use a different linker
+		if options.Linker != LinkerDefault {
+			args = append(args, "-fuse-ld="+options.Linker.String())
+		}
+
+		// Link the same C++ standard library that we compiled with
+		if cpp && options.StdLib != StdLibDefault {
+			args = append(args, "-stdlib="+options.StdLib.String())
+		}
 
 		if options.Static {
 			args = append(args, "-static")
@@ -143,9 +250,6 @@ func (ci darwinCompiler) Link(objDir, outPath string, outType LinkType, options
 			args = append(args, "-L"+dir)
 		}
 
-		// Link to some common standard libraries
-		args = append(args, "-lstdc++")
-
 		// Add libraries to link
 		for _, link := range options.LinkLibraries {
 			args = append(args, "-l"+link)
@@ -166,7 +270,7 @@ func (ci darwinCompiler) Link(objDir, outPath string, outType LinkType, options
 		return nil
 	})
 
-	cmd := exec.Command(exeName, args...)
+	cmd := ci.command(linker, args)
 
 	if options.Verbose {
 		log.Trace("%s", strings.Join(cmd.Args, " "))
@@ -178,7 +282,7 @@ func (ci darwinCompiler) Link(objDir, outPath string, outType LinkType, options
 		return "", errors.New(output)
 	}
 
-	if options.Debug {
+	if options.debugSymbols() {
 		cmd = exec.Command("dsymutil", outPath)
 		err := cmd.Run()
 		if err != nil {
@@ -186,6 +290,18 @@ func (ci darwinCompiler) Link(objDir, outPath string, outType LinkType, options
 		}
 	}
 
+	// Split debug information is only kept in the .dSYM bundle
+	if outType != LinkLib && options.DebugInfo == DebugInfoSplit {
+		cmd = exec.Command("strip", "-S", outPath)
+		if options.Verbose {
+			log.Trace("%s", strings.Join(cmd.Args, " "))
+		}
+		outputBytes, err := cmd.CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("strip failed: %s", strings.Trim(string(outputBytes), "\r\n"))
+		}
+	}
+
 	return outPath, nil
 }
 
@@ -195,3 +311,51 @@ func (ci darwinCompiler) Clean(name string) {
 	os.Remove(name + ".a")
 	os.RemoveAll(name + ".dSYM")
 }
+
+func (ci darwinCompiler) OutputFile(outPath string, outType LinkType) string {
+	switch outType {
+	case LinkDll:
+		return outPath + ".dylib"
+	case LinkLib:
+		return outPath + ".a"
+	}
+	return outPath
+}
+
+func (ci darwinCompiler) Toolset() string {
+	return ci.toolset
+}
+
+func (ci darwinCompiler) Version() string {
+	return ci.version
+}
+
+func (ci darwinCompiler) Details() []toolchainDetail {
+	includes, libs := gccSearchDirs(ci.cxx, ci.targetArgs())
+	return []toolchainDetail{
+		{"C compiler", []string{strings.Join(ci.cc, " ")}},
+		{"C++ compiler", []string{strings.Join(ci.cxx, " ")}},
+		{"archiver", []string{"ar"}},
+		{"linker", []string{gccLinker(ci.cc, ci.targetArgs())}},
+		{"include dirs", includes},
+		{"library dirs", libs},
+	}
+}
+
+func (ci darwinCompiler) ValidateOptions(options *CompilerOptions) error {
+	if options.Harden {
+		return errors.New("hardening is only supported on Linux and with msvc")
+	}
+	if options.SplitDWARF || options.CompressDebug {
+		return errors.New("split DWARF and compressed debug information are only supported on Linux")
+	}
+	return ci.caps.validateOptions(options)
+}
+
+func (ci darwinCompiler) CoverageEnv(objDir string) []string {
+	return coverageEnv(ci.caps.family, objDir)
+}
+
+func (ci darwinCompiler) Coverage(objDir, exePath string) ([]*coverageFile, error) {
+	return collectCoverage(ci.caps.family, ci.cc, objDir, exePath)
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,182 +14,135 @@ import (
 )
 
 type linuxCompiler struct {
+	gccCompiler
+
+	// toolset is the compiler family, either "clang" or "gcc".
 	toolset string
-}
 
-func (ci linuxCompiler) Compile(path, objDir string, options *CompilerOptions) error {
-	fileext := filepath.Ext(path)
-	filename := strings.TrimSuffix(filepath.Base(path), fileext)
+	// version is the version of the compiler.
+	version string
 
-	args := make([]string, 0)
-	args = append(args, "-c")
-	args = append(args, "-o", filepath.Join(objDir, filename+".o"))
-	args = append(args, "-std=c++17")
+	// objcopy and dwp are the commands that split debug information out of the binary.
+	objcopy string
+	dwp     string
 
-	// Set warnings flags
-	if options.Strict {
-		args = append(args, "-Wall")
-		args = append(args, "-Wextra")
-		args = append(args, "-Werror")
-	}
+	// target is the target triple, or empty when building for the host.
+	target string
+}
 
-	// Set debug flag
-	if options.Debug {
-		args = append(args, "-g")
+// splitDebugInfo moves the debug information of a binary into a separate .debug file, which debuggers find through
+// the .gnu_debuglink section that is added to the binary. With split DWARF, the .dwo files of the object files are
+// packaged into a .dwp file next to the binary as well, while the object files are still around.
+func (ci linuxCompiler) splitDebugInfo(outPath string, options *CompilerOptions) error {
+	commands := make([][]string, 0)
+	if options.SplitDWARF {
+		commands = append(commands, []string{ci.dwp, "-e", outPath, "-o", outPath + ".dwp"})
 	}
 
-	// Add optimization flags
-	if options.Optimization == OptimizeSize {
-		args = append(args, "-Os")
-	} else if options.Optimization == OptimizeSpeed {
-		args = append(args, "-O3")
+	keepDebug := []string{ci.objcopy, "--only-keep-debug"}
+	if options.CompressDebug {
+		keepDebug = append(keepDebug, "--compress-debug-sections")
 	}
+	commands = append(commands,
+		append(keepDebug, outPath, outPath+".debug"),
+		[]string{ci.objcopy, "--strip-debug", "--add-gnu-debuglink=" + outPath + ".debug", outPath},
+	)
 
-	// Add C++ standard flag
-	if fileext != ".c" {
-		switch options.CPPStandard {
-		case CPPStandardLatest:
-			args = append(args, "-std=c++23")
-		case CPPStandard20:
-			args = append(args, "-std=c++20")
-		case CPPStandard17:
-			args = append(args, "-std=c++17")
-		case CPPStandard14:
-			args = append(args, "-std=c++14")
+	for _, args := range commands {
+		cmd := exec.Command(args[0], args[1:]...)
+		if options.Verbose {
+			log.Trace("%s", strings.Join(cmd.Args, " "))
 		}
-	}
-
-	// Add C standard flag
-	if fileext == ".c" {
-		switch options.CStandard {
-		case CStandardLatest:
-			args = append(args, "-std=c2x")
-		case CStandard17:
-			args = append(args, "-std=c17")
-		case CStandard11:
-			args = append(args, "-std=c11")
+		outputBytes, err := cmd.CombinedOutput()
+		if output := strings.Trim(string(outputBytes), "\r\n"); err != nil && output != "" {
+			return fmt.Errorf("%s failed: %s", args[0], output)
+		} else if err != nil {
+			return fmt.Errorf("%s failed: %w", args[0], err)
 		}
 	}
+	return nil
+}
 
-	// Add include directories
-	for _, dir := range options.IncludeDirectories {
-		args = append(args, "-I"+dir)
-	}
+func (ci linuxCompiler) Link(objDir, outPath string, outType LinkType, options *CompilerOptions) (string, error) {
+	outPath = ci.OutputFile(outPath, outType)
 
-	// Add precompiler definitions
-	for _, define := range options.Defines {
-		args = append(args, "-D"+define)
+	err := ci.link(objDir, outPath, outType, options, nil)
+	if err != nil {
+		return "", err
 	}
 
-	// Add additional compiler flags for C/C++
-	args = append(args, options.CompilerFlagsCXX...)
-
-	// Add additional compiler flags for C++
-	if fileext != ".c" {
-		args = append(args, options.CompilerFlagsCPP...)
+	if outType != LinkLib && options.DebugInfo == DebugInfoSplit {
+		err = ci.splitDebugInfo(outPath, options)
+		if err != nil {
+			return "", err
+		}
 	}
+	return outPath, nil
+}
 
-	// Add additional compiler flags for C
-	if fileext == ".c" {
-		args = append(args, options.CompilerFlagsC...)
+func (ci linuxCompiler) Clean(name string) {
+	for _, outType := range []LinkType{LinkExe, LinkDll, LinkLib} {
+		outPath := ci.OutputFile(name, outType)
+		os.Remove(outPath)
+		os.Remove(outPath + ".debug")
+		os.Remove(outPath + ".dwp")
 	}
+}
 
-	args = append(args, path)
+func (ci linuxCompiler) OutputFile(outPath string, outType LinkType) string {
+	return outPath + outputSuffix(targetOS(ci.target), outType)
+}
 
-	cmd := exec.Command(ci.toolset, args...)
+func (ci linuxCompiler) Toolset() string {
+	return ci.toolset
+}
 
-	if options.Verbose {
-		log.Trace("%s", strings.Join(cmd.Args, " "))
-	}
+func (ci linuxCompiler) Version() string {
+	return ci.version
+}
 
-	outputBytes, err := cmd.CombinedOutput()
-	if err != nil {
-		output := strings.Trim(string(outputBytes), "\r\n")
-		return errors.New(output)
-	}
-	return nil
+func (ci linuxCompiler) Details() []toolchainDetail {
+	return ci.details()
 }
 
-func (ci linuxCompiler) Link(objDir, outPath string, outType LinkType, options *CompilerOptions) (string, error) {
-	args := make([]string, 0)
-
-	exeName := ci.toolset
-
-	switch outType {
-	case LinkExe:
-	case LinkDll:
-		outPath += ".so"
-		args = append(args, "-shared")
-	case LinkLib:
-		exeName = "ar"
-		outPath += ".a"
+func (ci linuxCompiler) ValidateOptions(options *CompilerOptions) error {
+	// The .dwo files are removed along with the object files, so they have to be packaged into a .dwp file
+	if options.SplitDWARF && options.DebugInfo != DebugInfoSplit {
+		return errors.New("split DWARF requires split debug information (--debuginfo split)")
 	}
+	return ci.caps.validateOptions(options)
+}
 
-	if outType == LinkLib {
-		// r = insert with replacement
-		// c = create new archie
-		// s = write an index
-		args = append(args, "rcs")
-		args = append(args, outPath)
-
-	} else {
-		args = append(args, "-o", outPath)
-
-		if ci.toolset == "gcc" {
-			args = append(args, "-static-libgcc")
-			args = append(args, "-static-libstdc++")
-		}
+func (ci linuxCompiler) CoverageEnv(objDir string) []string {
+	return coverageEnv(ci.caps.family, objDir)
+}
 
-		if options.Static {
-			args = append(args, "-static")
-		}
+func (ci linuxCompiler) Coverage(objDir, exePath string) ([]*coverageFile, error) {
+	return collectCoverage(ci.caps.family, ci.cc, objDir, exePath)
+}
 
-		// Add additional library paths
-		for _, dir := range options.LinkDirectories {
-			args = append(args, "-L"+dir)
-		}
+func (ci linuxCompiler) MergeProfiles(profilePath string) error {
+	// gcc reads its profiles as they are
+	ext := ".gcda"
+	if ci.toolset == "clang" {
+		ext = ".profraw"
 	}
-
-	filepath.Walk(objDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if info.IsDir() || !strings.HasSuffix(path, ".o") {
-			return nil
-		}
-		args = append(args, path)
+	profiles, err := findFiles(profilePath, ext)
+	if err != nil || len(profiles) == 0 {
+		return errors.New("no profiles were collected, run the program first")
+	}
+	if ci.toolset != "clang" {
 		return nil
-	})
-
-	if outType != LinkLib {
-		// Link to some common standard libraries
-		args = append(args, "-lstdc++")
-
-		// Add libraries to link
-		for _, link := range options.LinkLibraries {
-			args = append(args, "-l"+link)
-		}
-
-		// Add additional linker flags
-		args = append(args, options.LinkerFlags...)
 	}
 
-	cmd := exec.Command(exeName, args...)
-
-	if options.Verbose {
-		log.Trace("%s", strings.Join(cmd.Args, " "))
+	profdata, err := llvmTool(ci.cc, "llvm-profdata")
+	if err != nil {
+		return err
 	}
-
-	outputBytes, err := cmd.CombinedOutput()
+	args := append([]string{"merge", "-o", filepath.Join(profilePath, "merged.profdata")}, profiles...)
+	output, err := ci.command(profdata, args).CombinedOutput()
 	if err != nil {
-		output := strings.Trim(string(outputBytes), "\r\n")
-		return "", errors.New(output)
+		return errors.New(strings.Trim(string(output), "\r\n"))
 	}
-	return outPath, nil
-}
-
-func (ci linuxCompiler) Clean(name string) {
-	os.Remove(name)
-	os.Remove(name + ".so")
-	os.Remove(name + ".a")
+	return nil
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// mingwCompiler builds Windows binaries with MinGW-w64. It works on any host.
+type mingwCompiler struct {
+	gccCompiler
+
+	// target is the target triple, such as "x86_64-w64-mingw32".
+	target string
+
+	// version is the version of the compiler.
+	version string
+
+	// windres is the command that compiles resource scripts.
+	windres string
+}
+
+func (ci mingwCompiler) CompileResource(path, objDir string, options *CompilerOptions) error {
+	filename := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+	args := make([]string, 0)
+	args = append(args, "-O", "coff")
+	args = append(args, "-o", filepath.Join(objDir, filename+".res.o"))
+
+	// Resource scripts can include headers and use definitions too
+	for _, dir := range options.IncludeDirectories {
+		args = append(args, "-I"+dir)
+	}
+	for _, define := range options.Defines {
+		args = append(args, "-D"+define)
+	}
+
+	args = append(args, path)
+	return ci.run(exec.Command(ci.windres, args...), options)
+}
+
+func (ci mingwCompiler) Link(objDir, outPath string, outType LinkType, options *CompilerOptions) (string, error) {
+	outPath = ci.OutputFile(outPath, outType)
+
+	err := ci.link(objDir, outPath, outType, options, ci.importLibraryArgs(outPath, outType))
+	if err != nil {
+		return "", err
+	}
+	return outPath, nil
+}
+
+// importLibraryArgs returns the arguments that write the import library of a dynamic library, which other binaries
+// are linked with to use it.
+func (ci mingwCompiler) importLibraryArgs(outPath string, outType LinkType) []string {
+	if outType != LinkDll {
+		return nil
+	}
+	return []string{"-Wl,--out-implib," + outPath + ".a"}
+}
+
+func (ci mingwCompiler) Clean(name string) {
+	os.Remove(name + ".exe")
+	os.Remove(name + ".dll")
+	os.Remove(name + ".dll.a")
+	os.Remove(name + ".a")
+}
+
+func (ci mingwCompiler) OutputFile(outPath string, outType LinkType) string {
+	return outPath + outputSuffix("windows", outType)
+}
+
+func (ci mingwCompiler) Toolset() string {
+	return "mingw"
+}
+
+func (ci mingwCompiler) Version() string {
+	return ci.version
+}
+
+func (ci mingwCompiler) Details() []toolchainDetail {
+	details := ci.details()
+	return slices.Insert(details, 4, toolchainDetail{"resource compiler", []string{ci.windres}})
+}
+
+func (ci mingwCompiler) ValidateOptions(options *CompilerOptions) error {
+	if options.Harden {
+		return errors.New("hardening is only supported on Linux and with msvc")
+	}
+	if options.DebugInfo == DebugInfoSplit || options.SplitDWARF || options.CompressDebug {
+		return errors.New("split and compressed debug information are only supported on Linux and macOS")
+	}
+	return ci.caps.validateOptions(options)
+}
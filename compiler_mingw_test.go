@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestMingwOutputFile(t *testing.T) {
+	tests := []struct {
+		outType LinkType
+		want    string
+	}{
+		{LinkExe, "bin/app.exe"},
+		{LinkDll, "bin/app.dll"},
+		{LinkLib, "bin/app.a"},
+	}
+
+	ci := mingwCompiler{target: defaultMingwTarget}
+	for _, test := range tests {
+		if got := ci.OutputFile("bin/app", test.outType); got != test.want {
+			t.Errorf("OutputFile(%s) = %q, want %q", test.outType, got, test.want)
+		}
+	}
+}
+
+func TestIsMingw(t *testing.T) {
+	tests := []struct {
+		toolchain ToolchainOptions
+		want      bool
+	}{
+		{ToolchainOptions{}, false},
+		{ToolchainOptions{Toolset: "mingw"}, true},
+		{ToolchainOptions{Toolset: "gcc"}, false},
+		{ToolchainOptions{Target: "x86_64-w64-mingw32"}, true},
+		{ToolchainOptions{Target: "i686-w64-mingw32"}, true},
+		{ToolchainOptions{Target: "x86_64-pc-windows-msvc"}, false},
+		{ToolchainOptions{Target: "aarch64-linux-gnu"}, false},
+	}
+
+	for _, test := range tests {
+		if got := isMingw(test.toolchain); got != test.want {
+			t.Errorf("isMingw(%+v) = %t, want %t", test.toolchain, got, test.want)
+		}
+	}
+}
+
+func TestTargetOS(t *testing.T) {
+	tests := []struct {
+		triple string
+		want   string
+	}{
+		{"x86_64-w64-mingw32", "windows"},
+		{"x86_64-pc-windows-msvc", "windows"},
+		{"x86_64-pc-cygwin", "windows"},
+		{"aarch64-apple-darwin", "darwin"},
+		{"arm64-apple-macos14", "darwin"},
+		{"aarch64-linux-gnu", "linux"},
+		{"riscv64-unknown-elf", "linux"},
+	}
+
+	for _, test := range tests {
+		if got := targetOS(test.triple); got != test.want {
+			t.Errorf("targetOS(%q) = %q, want %q", test.triple, got, test.want)
+		}
+	}
+}
+
+func TestOutputSuffix(t *testing.T) {
+	tests := []struct {
+		goos    string
+		outType LinkType
+		want    string
+	}{
+		{"linux", LinkExe, ""},
+		{"linux", LinkDll, ".so"},
+		{"linux", LinkLib, ".a"},
+		{"darwin", LinkExe, ""},
+		{"darwin", LinkDll, ".dylib"},
+		{"darwin", LinkLib, ".a"},
+		{"windows", LinkExe, ".exe"},
+		{"windows", LinkDll, ".dll"},
+		{"windows", LinkLib, ".a"},
+	}
+
+	for _, test := range tests {
+		if got := outputSuffix(test.goos, test.outType); got != test.want {
+			t.Errorf("outputSuffix(%s, %s) = %q, want %q", test.goos, test.outType, got, test.want)
+		}
+	}
+}
+
+func TestMingwLinkLibraries(t *testing.T) {
+	// Libraries are given by name, which the MSVC linker (and not the host) turns into .lib filenames
+	loadTestProject(t, "link = [\"ws2_32\", \"user32\"]\n")
+	ctx := NewContext(nil)
+	loadCompilerOptions(ctx, &Configuration{}, nil)
+
+	if want := []string{"ws2_32", "user32"}; !reflect.DeepEqual(ctx.CompilerOptions.LinkLibraries, want) {
+		t.Errorf("LinkLibraries = %q, want %q", ctx.CompilerOptions.LinkLibraries, want)
+	}
+
+	ci := mingwCompiler{
+		gccCompiler: gccCompiler{
+			cc:   []string{"x86_64-w64-mingw32-gcc"},
+			cxx:  []string{"x86_64-w64-mingw32-g++"},
+			caps: &compilerCapabilities{family: "gcc"},
+		},
+		target: defaultMingwTarget,
+	}
+	outPath := ci.OutputFile(filepath.Join("bin", "app"), LinkDll)
+	cmd := ci.linkCommand(t.TempDir(), outPath, LinkDll, ctx.CompilerOptions, ci.importLibraryArgs(outPath, LinkDll))
+
+	for _, arg := range []string{"-shared", "-Wl,--out-implib," + outPath + ".a", "-lws2_32", "-luser32"} {
+		if !slices.Contains(cmd.Args, arg) {
+			t.Errorf("%q is missing %s", cmd.Args, arg)
+		}
+	}
+	for _, arg := range cmd.Args {
+		if strings.HasSuffix(arg, ".lib") {
+			t.Errorf("%q links a .lib file", cmd.Args)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckSplitDWARF(t *testing.T) {
+	tests := []struct {
+		outType LinkType
+		options CompilerOptions
+		ok      bool
+	}{
+		{LinkExe, CompilerOptions{DebugInfo: DebugInfoSplit, SplitDWARF: true}, true},
+		{LinkDll, CompilerOptions{DebugInfo: DebugInfoSplit, SplitDWARF: true}, true},
+		{LinkLib, CompilerOptions{DebugInfo: DebugInfoSplit, SplitDWARF: true}, false},
+		{LinkLib, CompilerOptions{DebugInfo: DebugInfoSplit}, true},
+	}
+
+	for _, test := range tests {
+		err := checkSplitDWARF(test.outType, &test.options)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("checkSplitDWARF(%s, %+v) = %v, want ok %t", test.outType, test.options, err, test.ok)
+		}
+	}
+}
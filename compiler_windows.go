@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/codecat/go-libs/log"
@@ -45,6 +46,19 @@ func (ci windowsCompiler) linker() string {
 	return filepath.Join(ci.binDir(), "link.exe")
 }
 
+// lldLinker returns the path of lld-link, either from the LLVM tools of Visual Studio or from the PATH. If it can't
+// be found, an empty string is returned.
+func (ci windowsCompiler) lldLinker() string {
+	path := filepath.Join(ci.installDir, "VC\\Tools\\Llvm\\x64\\bin\\lld-link.exe")
+	if fileExists(path) {
+		return path
+	}
+	if path, err := exec.LookPath("lld-link"); err == nil {
+		return path
+	}
+	return ""
+}
+
 func (ci windowsCompiler) libber() string {
 	return filepath.Join(ci.binDir(), "lib.exe")
 }
@@ -81,6 +95,44 @@ func (ci windowsCompiler) linkDirs() []string {
 }
 
 func (ci windowsCompiler) Compile(path, objDir string, options *CompilerOptions) error {
+	language := "c++"
+	if filepath.Ext(path) == ".c" {
+		language = "c"
+	}
+	return ci.compile(path, objDir, options, ci.pchArgs("/Yu", language, options))
+}
+
+func (ci windowsCompiler) CompileHeader(header, language string, options *CompilerOptions) error {
+	// The header is precompiled by compiling a source file that only includes it. The object of that source file is
+	// linked as well, as it contains the debug information of the precompiled header.
+	ext := ".cpp"
+	if language == "c" {
+		ext = ".c"
+	}
+	path, err := writePCHSource(options, language, strings.TrimSuffix(filepath.Base(header), filepath.Ext(header))+ext)
+	if err != nil {
+		return err
+	}
+	return ci.compile(path, pchLanguageDir(options, language), options, ci.pchArgs("/Yc", language, options))
+}
+
+// pchArgs returns the arguments that create (/Yc) or use (/Yu) the precompiled header of a language. Source files
+// that use it include the header automatically.
+func (ci windowsCompiler) pchArgs(mode, language string, options *CompilerOptions) []string {
+	if !usesPCH(language, options) {
+		return nil
+	}
+	header, _ := filepath.Abs(options.PCH)
+	header = filepath.ToSlash(header)
+	args := []string{mode + header, "/Fp" + filepath.Join(pchLanguageDir(options, language), filepath.Base(header)+".pch")}
+	if mode == "/Yu" {
+		args = append(args, "/FI"+header)
+	}
+	return args
+}
+
+// compile compiles a source file into the object directory with the given extra arguments.
+func (ci windowsCompiler) compile(path, objDir string, options *CompilerOptions, extraArgs []string) error {
 	// cl.exe args: https://learn.microsoft.com/en-us/cpp/build/reference/compiler-options-listed-by-category?view=msvc-170
 
 	fileext := filepath.Ext(path)
@@ -134,10 +186,15 @@ func (ci windowsCompiler) Compile(path, objDir string, options *CompilerOptions)
 		args = append(args, "/O2")
 	}
 
+	// Enable whole program optimization, which has no thin mode
+	if options.LTO != LTOOff {
+		args = append(args, "/GL")
+	}
+
 	// Add C++ standard flag
 	if fileext != ".c" {
 		switch options.CPPStandard {
-		case CPPStandardLatest:
+		case CPPStandardLatest, CPPStandard26, CPPStandard23:
 			args = append(args, "/std:c++latest")
 		case CPPStandard20:
 			args = append(args, "/std:c++20")
@@ -151,7 +208,7 @@ func (ci windowsCompiler) Compile(path, objDir string, options *CompilerOptions)
 	// Add C standard flag
 	if fileext == ".c" {
 		switch options.CStandard {
-		case CStandardLatest:
+		case CStandardLatest, CStandard23:
 			args = append(args, "/std:clatest")
 		case CStandard17:
 			args = append(args, "/std:c17")
@@ -160,6 +217,17 @@ func (ci windowsCompiler) Compile(path, objDir string, options *CompilerOptions)
 		}
 	}
 
+	// Add control flow guard checks
+	if options.Harden {
+		args = append(args, "/guard:cf")
+	}
+
+	// Add the address sanitizer, with debug information in the objects for useful reports
+	if slices.Contains(options.Sanitize, "address") {
+		args = append(args, "/fsanitize=address")
+		args = append(args, "/Z7")
+	}
+
 	// Add include directories
 	for _, dir := range options.IncludeDirectories {
 		args = append(args, "/I"+dir)
@@ -170,6 +238,9 @@ func (ci windowsCompiler) Compile(path, objDir string, options *CompilerOptions)
 		args = append(args, "/D"+define)
 	}
 
+	// Add the precompiled header
+	args = append(args, extraArgs...)
+
 	// Add additional compiler flags for C/C++
 	args = append(args, options.CompilerFlagsCXX...)
 
@@ -208,39 +279,59 @@ func (ci windowsCompiler) Link(objDir, outPath string, outType LinkType, options
 	// link.exe args: https://learn.microsoft.com/en-us/cpp/build/reference/linker-options?view=msvc-170
 
 	exeName := ci.linker()
+	if options.Linker == LinkerLLD {
+		exeName = ci.lldLinker()
+	}
 
 	args := make([]string, 0)
 	args = append(args, "/nologo")
 	args = append(args, "/machine:x64")
 	args = append(args, "/incremental:no")
 
-	if options.Debug {
+	if options.debugSymbols() || len(options.Sanitize) > 0 {
 		args = append(args, "/debug")
 	}
 
-	switch outType {
-	case LinkExe:
-		outPath += ".exe"
+	outPath = ci.OutputFile(outPath, outType)
 
+	switch outType {
 	case LinkDll:
-		outPath += ".dll"
 		args = append(args, "/dll")
 
 	case LinkLib:
 		exeName = ci.libber()
-		outPath += ".lib"
 		args = append(args, "/lib")
 	}
 
 	args = append(args, "/out:"+outPath)
 
+	// Enable control flow guard, address space layout randomization, data execution prevention, and Intel CET
+	// shadow stacks
+	if options.Harden && outType != LinkLib {
+		args = append(args, "/guard:cf")
+		args = append(args, "/dynamicbase")
+		args = append(args, "/highentropyva")
+		args = append(args, "/nxcompat")
+		args = append(args, "/cetcompat")
+	}
+
+	// Objects compiled with /GL have to be linked with link-time code generation
+	if options.LTO != LTOOff {
+		args = append(args, "/ltcg")
+	}
+
 	// Add additional library paths
 	for _, dir := range options.LinkDirectories {
 		args = append(args, "/libpath:"+dir)
 	}
 
-	// Add libraries to link
-	args = append(args, options.LinkLibraries...)
+	// Add libraries to link, which are passed as filenames
+	for _, link := range options.LinkLibraries {
+		if !strings.HasSuffix(strings.ToLower(link), ".lib") {
+			link += ".lib"
+		}
+		args = append(args, link)
+	}
 
 	// Add additional linker flags
 	args = append(args, options.LinkerFlags...)
@@ -285,3 +376,68 @@ func (ci windowsCompiler) Clean(name string) {
 	os.Remove(name + ".lib")
 	os.Remove(name + ".pdb")
 }
+
+func (ci windowsCompiler) OutputFile(outPath string, outType LinkType) string {
+	switch outType {
+	case LinkExe:
+		return outPath + ".exe"
+	case LinkDll:
+		return outPath + ".dll"
+	case LinkLib:
+		return outPath + ".lib"
+	}
+	return outPath
+}
+
+func (ci windowsCompiler) Toolset() string {
+	return "msvc"
+}
+
+func (ci windowsCompiler) Version() string {
+	return ci.installVersion
+}
+
+func (ci windowsCompiler) Details() []toolchainDetail {
+	return []toolchainDetail{
+		{"installation", []string{ci.installDir}},
+		{"Windows SDK", []string{ci.sdkDir + " (" + ci.sdkVersion + ")"}},
+		{"compiler", []string{ci.compiler()}},
+		{"archiver", []string{ci.libber()}},
+		{"linker", []string{ci.linker()}},
+		{"include dirs", ci.includeDirs()},
+		{"library dirs", ci.linkDirs()},
+	}
+}
+
+func (ci windowsCompiler) ValidateOptions(options *CompilerOptions) error {
+	if options.StdLib != StdLibDefault {
+		return fmt.Errorf("msvc can only use its own C++ standard library, not %s", options.StdLib)
+	}
+
+	// Debug information always goes into a separate .pdb file
+	if options.SplitDWARF || options.CompressDebug {
+		return errors.New("split DWARF and compressed debug information are only supported on Linux")
+	}
+
+	switch options.Linker {
+	case LinkerDefault:
+	case LinkerLLD:
+		if ci.lldLinker() == "" {
+			return errors.New("couldn't find lld-link, install the C++ Clang tools for Windows in Visual Studio or add LLVM to the PATH")
+		}
+	default:
+		return fmt.Errorf("msvc can only link with link or lld-link, not %s", options.Linker)
+	}
+
+	for _, sanitizer := range options.Sanitize {
+		if sanitizer != "address" {
+			return fmt.Errorf("msvc only supports the address sanitizer, not %s", sanitizer)
+		}
+	}
+
+	// lld-link can't read the intermediate code in objects that are compiled with /GL
+	if options.LTO != LTOOff && options.Linker == LinkerLLD {
+		return errors.New("link-time optimization with msvc requires the link linker, not lld")
+	}
+	return nil
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"os"
 	"regexp"
-	"runtime"
 	"strings"
 
 	"github.com/codecat/go-libs/log"
@@ -54,8 +53,6 @@ func addConanPackages(ctx *Context, conan Conanfile) {
 
 	log.Info("Adding Conan packages")
 
-	isWindows := runtime.GOOS == "windows"
-
 	// contains .h files
 	ctx.CompilerOptions.IncludeDirectories = append(ctx.CompilerOptions.IncludeDirectories, conan["includedirs"]...)
 
@@ -63,20 +60,10 @@ func addConanPackages(ctx *Context, conan Conanfile) {
 	ctx.CompilerOptions.LinkDirectories = append(ctx.CompilerOptions.LinkDirectories, conan["libdirs"]...)
 
 	// libraries to link to
-	for _, lib := range conan["libs"] {
-		if isWindows && !strings.HasSuffix(lib, ".lib") {
-			lib += ".lib"
-		}
-		ctx.CompilerOptions.LinkLibraries = append(ctx.CompilerOptions.LinkLibraries, lib)
-	}
+	ctx.CompilerOptions.LinkLibraries = append(ctx.CompilerOptions.LinkLibraries, conan["libs"]...)
 
 	// additional system libraries to link to
-	for _, lib := range conan["system_libs"] {
-		if isWindows && !strings.HasSuffix(lib, ".lib") {
-			lib += ".lib"
-		}
-		ctx.CompilerOptions.LinkLibraries = append(ctx.CompilerOptions.LinkLibraries, lib)
-	}
+	ctx.CompilerOptions.LinkLibraries = append(ctx.CompilerOptions.LinkLibraries, conan["system_libs"]...)
 
 	// precompiler defines to add
 	ctx.CompilerOptions.Defines = append(ctx.CompilerOptions.Defines, conan["defines"]...)
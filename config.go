@@ -0,0 +1,302 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/codecat/go-libs/log"
+	"github.com/spf13/viper"
+)
+
+// configSettings contains the merged settings from the configuration file.
+var configSettings map[string]interface{}
+
+// configToolsetSections contains the [toolset.name] sections of the configuration files. These can only be applied
+// once we know which toolset is being used.
+var configToolsetSections []toolsetConfig
+
+// toolsetConfig contains the [toolset.name] sections of a single configuration file.
+type toolsetConfig struct {
+	path     string
+	sections map[string]interface{}
+}
+
+// configOrigins contains the configuration file (and section) that each setting came from. Entries of lists that
+// are appended to are stored as "key=entry".
+var configOrigins = make(map[string]string)
+
+// loadConfig reads the global configuration files and the qb configuration file, if they exist, along with any
+// configuration files they extend. The [os.name] section for the current operating system is merged on top of
+// each of them.
+func loadConfig() error {
+	configSettings = make(map[string]interface{})
+
+	// The global configuration files go beneath the project configuration file
+	for _, path := range globalConfigFiles() {
+		if !fileExists(path) {
+			continue
+		}
+
+		log.Info("Using global configuration file %s", path)
+
+		settings, err := readConfigFile(path, nil)
+		if err != nil {
+			return err
+		}
+		mergeSettings(configSettings, settings)
+	}
+
+	v := viper.New()
+	v.AddConfigPath(".")
+	v.SetConfigName("qb")
+
+	err := v.ReadInConfig()
+	if err == nil {
+		log.Info("Using build configuration file %s", filepath.Base(v.ConfigFileUsed()))
+
+		settings, err := resolveConfigFile(v, nil)
+		if err != nil {
+			return err
+		}
+		mergeSettings(configSettings, settings)
+
+	} else {
+		var notFound viper.ConfigFileNotFoundError
+		if !errors.As(err, &notFound) {
+			return err
+		}
+	}
+
+	return viper.MergeConfigMap(configSettings)
+}
+
+// globalConfigFiles returns the paths of the system-wide and user configuration files, in the order they should be
+// loaded in. It's a variable so that tests don't depend on the configuration of the system they run on.
+var globalConfigFiles = func() []string {
+	ret := make([]string, 0, 2)
+
+	if runtime.GOOS == "windows" {
+		if programData := os.Getenv("ProgramData"); programData != "" {
+			ret = append(ret, filepath.Join(programData, "qb", "qb.toml"))
+		}
+	} else {
+		ret = append(ret, "/etc/qb/qb.toml")
+	}
+
+	// On Linux, this is $XDG_CONFIG_HOME or ~/.config
+	if configDir, err := os.UserConfigDir(); err == nil {
+		ret = append(ret, filepath.Join(configDir, "qb", "qb.toml"))
+	}
+
+	return ret
+}
+
+// readConfigFile reads a configuration file that is extended by another configuration file.
+func readConfigFile(path string, parents []string) (map[string]interface{}, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+
+	err := v.ReadInConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveConfigFile(v, parents)
+}
+
+// resolveConfigFile returns the settings of a configuration file that has been read, merged on top of the settings
+// of the configuration files it extends. The parents are the paths of the configuration files that are currently
+// being resolved, which is used to detect cycles.
+func resolveConfigFile(v *viper.Viper, parents []string) (map[string]interface{}, error) {
+	path, err := filepath.Abs(v.ConfigFileUsed())
+	if err != nil {
+		return nil, err
+	}
+
+	if slices.Contains(parents, path) {
+		cycle := append(parents[slices.Index(parents, path):], path)
+		return nil, fmt.Errorf("configuration files extend each other in a cycle: %s", strings.Join(cycle, " -> "))
+	}
+	parents = append(parents, path)
+
+	settings := v.AllSettings()
+	validateConfig(v.ConfigFileUsed(), settings)
+
+	// Relative paths are relative to the configuration file that sets them, not to the project that uses it
+	rebasePaths(settings, filepath.Dir(path))
+
+	// Find the configuration files we extend, which can be a single path or a list of paths
+	var extends []string
+	switch value := settings["extends"].(type) {
+	case nil:
+	case string:
+		extends = []string{value}
+	case []interface{}:
+		for _, item := range value {
+			extends = append(extends, fmt.Sprint(item))
+		}
+	default:
+		return nil, fmt.Errorf("extends in %s must be a path or a list of paths", path)
+	}
+	delete(settings, "extends")
+
+	// Load the configuration files we extend first, so that our own settings will override them
+	ret := make(map[string]interface{})
+	for _, extend := range extends {
+		if !filepath.IsAbs(extend) {
+			extend = filepath.Join(filepath.Dir(path), extend)
+		}
+
+		extendSettings, err := readConfigFile(extend, parents)
+		if err != nil {
+			return nil, fmt.Errorf("unable to extend %s: %w", extend, err)
+		}
+		mergeSettings(ret, extendSettings)
+	}
+
+	// Take out the conditional sections, so that they don't end up as regular settings
+	osSections, _ := settings["os"].(map[string]interface{})
+	delete(settings, "os")
+
+	if sections, ok := settings["toolset"].(map[string]interface{}); ok {
+		configToolsetSections = append(configToolsetSections, toolsetConfig{
+			path:     path,
+			sections: sections,
+		})
+		delete(settings, "toolset")
+	}
+
+	recordOrigins("", settings, displayPath(path))
+
+	// Merge the section for the current operating system on top of the base configuration
+	if section, ok := osSections[runtime.GOOS].(map[string]interface{}); ok {
+		recordOrigins("", section, fmt.Sprintf("%s [os.%s]", displayPath(path), runtime.GOOS))
+		mergeSettings(settings, section)
+	}
+
+	mergeSettings(ret, settings)
+	return ret, nil
+}
+
+// applyToolsetConfig merges the [toolset.name] sections for the given toolset on top of the configuration.
+func applyToolsetConfig(toolset string) error {
+	for _, ts := range configToolsetSections {
+		section, ok := ts.sections[toolset].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		recordOrigins("", section, fmt.Sprintf("%s [toolset.%s]", displayPath(ts.path), toolset))
+		mergeSettings(configSettings, section)
+	}
+	return viper.MergeConfigMap(configSettings)
+}
+
+// recordOrigins remembers that the given settings came from origin. This has to be called in the same order as the
+// settings are merged, so that the origin of a setting is the last one that changed it.
+func recordOrigins(prefix string, settings map[string]interface{}, origin string) {
+	for key, value := range settings {
+		if table, ok := value.(map[string]interface{}); ok {
+			recordOrigins(prefix+key+".", table, origin)
+			continue
+		}
+
+		configOrigins[prefix+key] = origin
+
+		if list, ok := value.([]interface{}); ok && appendSettings[key] {
+			for _, item := range list {
+				configOrigins[prefix+key+"="+fmt.Sprint(item)] = origin
+			}
+		}
+	}
+}
+
+// displayPath returns the path relative to the current directory, if possible.
+func displayPath(path string) string {
+	currentDir, _ := filepath.Abs(".")
+	if rel, err := filepath.Rel(currentDir, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// pathSettings are the settings that contain paths, including those in [package.name] tables.
+var pathSettings = map[string]bool{
+	"include":  true,
+	"linkdir":  true,
+	"pch":      true,
+	"sysroot":  true,
+	"includes": true,
+	"linkdirs": true,
+}
+
+// rebasePaths makes the relative paths in the settings, and in any of its tables, relative to dir instead. The paths
+// are kept relative to the current directory if they're inside of it.
+func rebasePaths(settings map[string]interface{}, dir string) {
+	rebase := func(value interface{}) interface{} {
+		path, ok := value.(string)
+		if !ok || path == "" || filepath.IsAbs(path) {
+			return value
+		}
+		return displayPath(filepath.Join(dir, path))
+	}
+
+	for key, value := range settings {
+		if table, ok := value.(map[string]interface{}); ok {
+			rebasePaths(table, dir)
+			continue
+		}
+		if !pathSettings[key] {
+			continue
+		}
+
+		if list, ok := value.([]interface{}); ok {
+			for i, item := range list {
+				list[i] = rebase(item)
+			}
+			continue
+		}
+		settings[key] = rebase(value)
+	}
+}
+
+// appendSettings are the settings of which list values are appended to the existing values when merging, instead
+// of replacing them.
+var appendSettings = map[string]bool{
+	"include":  true,
+	"define":   true,
+	"pkg":      true,
+	"link":     true,
+	"linkdir":  true,
+	"cflags":   true,
+	"cxxflags": true,
+	"ldflags":  true,
+}
+
+// mergeSettings merges src on top of dest. Tables are merged recursively, and other values are replaced, except
+// for lists in appendSettings, which are appended.
+func mergeSettings(dest, src map[string]interface{}) {
+	for key, value := range src {
+		if srcMap, ok := value.(map[string]interface{}); ok {
+			if destMap, ok := dest[key].(map[string]interface{}); ok {
+				mergeSettings(destMap, srcMap)
+				continue
+			}
+		}
+
+		if appendSettings[key] {
+			srcList, srcOk := value.([]interface{})
+			destList, destOk := dest[key].([]interface{})
+			if srcOk && destOk {
+				dest[key] = append(destList, srcList...)
+				continue
+			}
+		}
+
+		dest[key] = value
+	}
+}
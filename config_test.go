@@ -0,0 +1,220 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestMergeSettings(t *testing.T) {
+	tests := []struct {
+		name string
+		dest map[string]interface{}
+		src  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "new setting",
+			dest: map[string]interface{}{"name": "app"},
+			src:  map[string]interface{}{"static": true},
+			want: map[string]interface{}{"name": "app", "static": true},
+		},
+		{
+			name: "value is replaced",
+			dest: map[string]interface{}{"type": "exe"},
+			src:  map[string]interface{}{"type": "dll"},
+			want: map[string]interface{}{"type": "dll"},
+		},
+		{
+			name: "appended list",
+			dest: map[string]interface{}{"define": []interface{}{"A"}},
+			src:  map[string]interface{}{"define": []interface{}{"B"}},
+			want: map[string]interface{}{"define": []interface{}{"A", "B"}},
+		},
+		{
+			name: "replaced list",
+			dest: map[string]interface{}{"configs": []interface{}{"debug"}},
+			src:  map[string]interface{}{"configs": []interface{}{"release"}},
+			want: map[string]interface{}{"configs": []interface{}{"release"}},
+		},
+		{
+			name: "tables are merged",
+			dest: map[string]interface{}{"profile": map[string]interface{}{"debug": map[string]interface{}{"debug": true}}},
+			src:  map[string]interface{}{"profile": map[string]interface{}{"release": map[string]interface{}{"optimize": "speed"}}},
+			want: map[string]interface{}{"profile": map[string]interface{}{
+				"debug":   map[string]interface{}{"debug": true},
+				"release": map[string]interface{}{"optimize": "speed"},
+			}},
+		},
+		{
+			name: "lists in tables are appended",
+			dest: map[string]interface{}{"profile": map[string]interface{}{"debug": map[string]interface{}{"define": []interface{}{"DEBUG"}}}},
+			src:  map[string]interface{}{"profile": map[string]interface{}{"debug": map[string]interface{}{"define": []interface{}{"TRACE"}}}},
+			want: map[string]interface{}{"profile": map[string]interface{}{"debug": map[string]interface{}{"define": []interface{}{"DEBUG", "TRACE"}}}},
+		},
+		{
+			name: "table replaces value",
+			dest: map[string]interface{}{"toolset": "gcc"},
+			src:  map[string]interface{}{"toolset": map[string]interface{}{"gcc": map[string]interface{}{}}},
+			want: map[string]interface{}{"toolset": map[string]interface{}{"gcc": map[string]interface{}{}}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mergeSettings(test.dest, test.src)
+			if !reflect.DeepEqual(test.dest, test.want) {
+				t.Errorf("got %v, want %v", test.dest, test.want)
+			}
+		})
+	}
+}
+
+func TestReadConfigFileOSSection(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "qb.toml")
+	config := "type = \"exe\"\ndefine = [\"BASE\"]\n\n[os." + runtime.GOOS + "]\ntype = \"dll\"\ndefine = [\"OS\"]\n\n[os.other]\ntype = \"lib\"\n"
+	if err := os.WriteFile(path, []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	settings, err := readConfigFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"type":   "dll",
+		"define": []interface{}{"BASE", "OS"},
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("got %v, want %v", settings, want)
+	}
+}
+
+func TestReadConfigFileExtends(t *testing.T) {
+	root := t.TempDir()
+	common := filepath.Join(root, "common")
+	project := filepath.Join(root, "project")
+	for _, dir := range []string{common, project} {
+		if err := os.Mkdir(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	absInclude := filepath.Join(root, "abs", "include")
+	files := map[string]string{
+		filepath.Join(common, "qb.toml"):  "type = \"lib\"\ninclude = [\"include\", \"" + filepath.ToSlash(absInclude) + "\"]\npch = \"pch.h\"\n\n[package.sdk]\nincludes = [\"sdk/include\"]\n",
+		filepath.Join(project, "qb.toml"): "extends = \"../common/qb.toml\"\ntype = \"exe\"\ninclude = [\"src\"]\n",
+	}
+	for path, config := range files {
+		if err := os.WriteFile(path, []byte(config), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Paths are shown relative to the current directory when they're inside of it
+	chdir(t, project)
+
+	settings, err := readConfigFile(filepath.Join(project, "qb.toml"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"type":    "exe",
+		"include": []interface{}{filepath.Join(common, "include"), filepath.ToSlash(absInclude), "src"},
+		"pch":     filepath.Join(common, "pch.h"),
+		"package": map[string]interface{}{
+			"sdk": map[string]interface{}{"includes": []interface{}{filepath.Join(common, "sdk", "include")}},
+		},
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("got %v, want %v", settings, want)
+	}
+}
+
+func TestReadConfigFileExtendsCycle(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.toml")
+	b := filepath.Join(dir, "b.toml")
+	os.WriteFile(a, []byte("extends = \"b.toml\"\n"), 0666)
+	os.WriteFile(b, []byte("extends = \"a.toml\"\n"), 0666)
+
+	if _, err := readConfigFile(a, nil); err == nil {
+		t.Error("expected an error for extending in a cycle")
+	}
+}
+
+func TestLoadConfigGlobalPaths(t *testing.T) {
+	root := t.TempDir()
+	configDir := filepath.Join(root, "config", "qb")
+	project := filepath.Join(root, "project")
+	for _, dir := range []string{configDir, project} {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+	absLib := filepath.Join(root, "opt", "sdk", "lib")
+	config := "[package.sdk]\nincludes = [\"sdk/include\"]\nlinkdirs = [\"" + filepath.ToSlash(absLib) + "\"]\n"
+	if err := os.WriteFile(filepath.Join(configDir, "qb.toml"), []byte(config), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	resetConfig(t, filepath.Join(configDir, "qb.toml"))
+	chdir(t, project)
+
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The paths are relative to the global configuration file, whichever project is being built
+	want := map[string]interface{}{
+		"includes": []interface{}{filepath.Join(configDir, "sdk", "include")},
+		"linkdirs": []interface{}{filepath.ToSlash(absLib)},
+	}
+	packages, _ := configSettings["package"].(map[string]interface{})
+	if !reflect.DeepEqual(packages["sdk"], want) {
+		t.Errorf("got %v, want %v", packages["sdk"], want)
+	}
+}
+
+// resetConfig clears the loaded configuration, and makes loadConfig read the given global configuration files
+// instead of those of the system. Everything is restored when the test is done.
+func resetConfig(t *testing.T, globalFiles ...string) {
+	reset := func() {
+		viper.Reset()
+		configSettings = nil
+		configOrigins = make(map[string]string)
+		configToolsetSections = nil
+		configIssues = nil
+	}
+
+	oldGlobalConfigFiles := globalConfigFiles
+	t.Cleanup(func() {
+		globalConfigFiles = oldGlobalConfigFiles
+		reset()
+	})
+
+	globalConfigFiles = func() []string {
+		return globalFiles
+	}
+	reset()
+}
+
+// chdir changes the current directory for the rest of the test.
+func chdir(t *testing.T, dir string) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(currentDir)
+	})
+}
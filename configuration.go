@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// builtinProfiles are the profiles that can be used without defining them in the configuration file. A
+// [profile.name] table in the configuration file with the same name will override these.
+var builtinProfiles = map[string]map[string]interface{}{
+	"debug":   {"debug": true},
+	"release": {"debug": false},
+	"static":  {"static": true},
+	"dynamic": {"static": false},
+}
+
+// Configuration is a single variant of the build, such as "debug" or "release". It is made up of one or more
+// profiles, of which the values take precedence over the command line and the configuration file.
+type Configuration struct {
+	// Name is the name of the configuration, which is also used as the name of the output sub-directory. This is
+	// empty for the default configuration.
+	Name string
+
+	overrides       map[string]interface{}
+	overrideOrigins map[string]string
+}
+
+// bindFlags binds the command line flags and QB_* environment variables to viper. The --profile flag is bound to
+// the "configs" key, so that "profile" stays available for the [profile.name] tables in the configuration file.
+func bindFlags() {
+	pflag.VisitAll(func(flag *pflag.Flag) {
+		if key := flagKey(flag.Name); key != "" {
+			viper.BindPFlag(key, flag)
+			viper.BindEnv(key, envName(key))
+		}
+	})
+}
+
+// envName returns the name of the environment variable that can be used to set the given key, for example
+// QB_STRICT_CONFIG for "strict-config".
+func envName(key string) string {
+	return "QB_" + strings.ToUpper(strings.ReplaceAll(keyFlag(key), "-", "_"))
+}
+
+// toStringSlice converts a value to a slice of strings. Strings are split on commas, so that lists can be passed
+// through environment variables, like QB_DEFINE=FOO,BAR.
+func toStringSlice(value interface{}) []string {
+	str, ok := value.(string)
+	if !ok {
+		return cast.ToStringSlice(value)
+	}
+	return splitList(str)
+}
+
+// splitList splits a comma separated list.
+func splitList(str string) []string {
+	ret := make([]string, 0)
+	for _, item := range strings.Split(str, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// getConfigurations returns all configurations that have to be built. Configurations are separated by commas,
+// and profiles within a single configuration can be combined with a plus sign, for example "debug+static".
+func getConfigurations() ([]*Configuration, error) {
+	names := toStringSlice(viper.Get("configs"))
+	if len(names) == 0 {
+		return []*Configuration{{}}, nil
+	}
+
+	ret := make([]*Configuration, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		config := &Configuration{
+			Name:            name,
+			overrides:       make(map[string]interface{}),
+			overrideOrigins: make(map[string]string),
+		}
+
+		for _, profile := range strings.Split(name, "+") {
+			values, err := getProfile(profile)
+			if err != nil {
+				return nil, err
+			}
+			for key, value := range values {
+				key = strings.ToLower(key)
+				config.overrides[key] = value
+				config.overrideOrigins[key] = "profile " + profile
+			}
+		}
+
+		ret = append(ret, config)
+	}
+
+	if len(ret) == 0 {
+		return []*Configuration{{}}, nil
+	}
+	return ret, nil
+}
+
+func getProfile(name string) (map[string]interface{}, error) {
+	if values := viper.GetStringMap("profile." + name); len(values) > 0 {
+		return values, nil
+	}
+	if values, ok := builtinProfiles[name]; ok {
+		return values, nil
+	}
+	return nil, fmt.Errorf("unknown profile %s", name)
+}
+
+// Get returns the value of the given key for this configuration.
+func (c *Configuration) Get(key string) interface{} {
+	if value, ok := c.overrides[key]; ok {
+		return value
+	}
+	return viper.Get(key)
+}
+
+// GetString returns the value of the given key as a string.
+func (c *Configuration) GetString(key string) string {
+	return cast.ToString(c.Get(key))
+}
+
+// GetBool returns the value of the given key as a boolean.
+func (c *Configuration) GetBool(key string) bool {
+	return cast.ToBool(c.Get(key))
+}
+
+// GetStringSlice returns the value of the given key as a slice of strings.
+func (c *Configuration) GetStringSlice(key string) []string {
+	value := c.Get(key)
+
+	// Options that take raw flags are not split on commas, as flags like -Wl,-rpath contain commas themselves
+	if str, ok := value.(string); ok {
+		if flag := pflag.Lookup(keyFlag(key)); flag != nil && flag.Value.Type() == "stringArray" {
+			return []string{str}
+		}
+	}
+
+	return toStringSlice(value)
+}
+
+// Origin returns a description of where the value of the given key came from. For lists, entry can be used to find
+// where a specific entry in the list came from.
+func (c *Configuration) Origin(key, entry string) string {
+	if origin, ok := c.overrideOrigins[key]; ok {
+		return origin
+	}
+
+	if flag := pflag.Lookup(keyFlag(key)); flag != nil && flag.Changed {
+		return "command line"
+	}
+
+	if os.Getenv(envName(key)) != "" {
+		return "environment variable " + envName(key)
+	}
+
+	if origin, ok := configOrigins[key+"="+entry]; ok && entry != "" {
+		return origin
+	}
+	if origin, ok := configOrigins[key]; ok {
+		return origin
+	}
+
+	return "default"
+}
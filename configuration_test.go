@@ -0,0 +1,254 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+// loadTestProject loads a project with the given configuration file (if not empty) and command line arguments,
+// as qb would from the project directory.
+func loadTestProject(t *testing.T, config string, args ...string) {
+	dir := t.TempDir()
+	if config != "" {
+		if err := os.WriteFile(filepath.Join(dir, "qb.toml"), []byte(config), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	chdir(t, dir)
+
+	resetConfig(t)
+	parseFlags(t, args...)
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// parseFlags defines qb's command line flags on a new flag set, parses the arguments, and binds them to viper. The
+// original flag set is restored when the test is done.
+func parseFlags(t *testing.T, args ...string) {
+	oldCommandLine := pflag.CommandLine
+	t.Cleanup(func() {
+		pflag.CommandLine = oldCommandLine
+	})
+
+	pflag.CommandLine = pflag.NewFlagSet("qb", pflag.ContinueOnError)
+	defineFlags()
+	if err := pflag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	bindFlags()
+}
+
+func TestGetConfigurations(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		args   []string
+		env    string
+		want   map[string]map[string]interface{}
+	}{
+		{
+			name: "default configuration",
+			want: map[string]map[string]interface{}{"": nil},
+		},
+		{
+			name: "profiles separated by commas",
+			args: []string{"--profile", "debug,release"},
+			want: map[string]map[string]interface{}{
+				"debug":   {"debug": true},
+				"release": {"debug": false},
+			},
+		},
+		{
+			name: "repeated profile flags",
+			args: []string{"--profile", "debug", "--profile", "static"},
+			want: map[string]map[string]interface{}{
+				"debug":  {"debug": true},
+				"static": {"static": true},
+			},
+		},
+		{
+			name: "combined profiles",
+			args: []string{"--profile", "debug+static"},
+			want: map[string]map[string]interface{}{
+				"debug+static": {"debug": true, "static": true},
+			},
+		},
+		{
+			name: "profiles from the environment",
+			env:  "release, dynamic",
+			want: map[string]map[string]interface{}{
+				"release": {"debug": false},
+				"dynamic": {"static": false},
+			},
+		},
+		{
+			name:   "profiles from the configuration file",
+			config: "configs = [\"debug\", \"release\"]\n",
+			want: map[string]map[string]interface{}{
+				"debug":   {"debug": true},
+				"release": {"debug": false},
+			},
+		},
+		{
+			name:   "profile table replaces the builtin profile",
+			config: "[profile.debug]\noptimize = \"none\"\ndefine = [\"TRACE\"]\n",
+			args:   []string{"--profile", "debug"},
+			want: map[string]map[string]interface{}{
+				"debug": {"optimize": "none", "define": []interface{}{"TRACE"}},
+			},
+		},
+		{
+			name:   "custom profile",
+			config: "[profile.asan]\nsanitize = [\"address\"]\n",
+			args:   []string{"--profile", "asan+debug"},
+			want: map[string]map[string]interface{}{
+				"asan+debug": {"sanitize": []interface{}{"address"}, "debug": true},
+			},
+		},
+		{
+			name:   "later profiles override earlier ones",
+			config: "[profile.fast]\ndebug = false\noptimize = \"speed\"\n",
+			args:   []string{"--profile", "debug+fast"},
+			want: map[string]map[string]interface{}{
+				"debug+fast": {"debug": false, "optimize": "speed"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("QB_PROFILE", test.env)
+			loadTestProject(t, test.config, test.args...)
+
+			configs, err := getConfigurations()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string]map[string]interface{})
+			for _, config := range configs {
+				got[config.Name] = config.overrides
+			}
+			if len(configs) != len(test.want) || !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestGetConfigurationsOrder(t *testing.T) {
+	loadTestProject(t, "", "--profile", "release,debug,static")
+
+	configs, err := getConfigurations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := make([]string, len(configs))
+	for i, config := range configs {
+		names[i] = config.Name
+	}
+	if want := []string{"release", "debug", "static"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("got %v, want %v", names, want)
+	}
+}
+
+func TestGetConfigurationsUnknownProfile(t *testing.T) {
+	for _, profile := range []string{"nope", "debug+nope"} {
+		loadTestProject(t, "[profile.fast]\noptimize = \"speed\"\n", "--profile", profile)
+
+		if _, err := getConfigurations(); err == nil {
+			t.Errorf("expected an error for the unknown profile in %s", profile)
+		}
+	}
+}
+
+func TestConfigurationPrecedence(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		env    string
+		args   []string
+		want   string
+		origin string
+	}{
+		{
+			name:   "default",
+			want:   "default",
+			origin: "default",
+		},
+		{
+			name:   "configuration file",
+			config: "optimize = \"size\"\n",
+			want:   "size",
+			origin: "qb.toml",
+		},
+		{
+			name:   "environment over configuration file",
+			config: "optimize = \"size\"\n",
+			env:    "none",
+			want:   "none",
+			origin: "environment variable QB_OPTIMIZE",
+		},
+		{
+			name:   "command line over environment",
+			config: "optimize = \"size\"\n",
+			env:    "none",
+			args:   []string{"--optimize", "speed"},
+			want:   "speed",
+			origin: "command line",
+		},
+		{
+			name:   "profile over command line",
+			config: "optimize = \"size\"\n\n[profile.small]\noptimize = \"size\"\n",
+			env:    "none",
+			args:   []string{"--optimize", "speed", "--profile", "small"},
+			want:   "size",
+			origin: "profile small",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("QB_PROFILE", "")
+			t.Setenv("QB_OPTIMIZE", test.env)
+			loadTestProject(t, test.config, test.args...)
+
+			configs, err := getConfigurations()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config := configs[0]
+			if got := config.GetString("optimize"); got != test.want {
+				t.Errorf("optimize = %q, want %q", got, test.want)
+			}
+			if got := config.Origin("optimize", ""); got != test.origin {
+				t.Errorf("origin = %q, want %q", got, test.origin)
+			}
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		str  string
+		want []string
+	}{
+		{"", []string{}},
+		{"debug", []string{"debug"}},
+		{"debug,release", []string{"debug", "release"}},
+		{" debug , release ,", []string{"debug", "release"}},
+	}
+
+	for _, test := range tests {
+		if got := splitList(test.str); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitList(%q) = %v, want %v", test.str, got, test.want)
+		}
+	}
+}
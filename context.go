@@ -1,14 +1,22 @@
 package main
 
+import (
+	"sync"
+	"sync/atomic"
+)
+
 // Context contains all the build system states that have to be remembered.
 type Context struct {
 	// Name is the name of the project.
 	Name string
 
+	// ConfigurationName is the name of the configuration that is being built, or empty for the default configuration.
+	ConfigurationName string
+
 	// Final binary type we want to link.
 	Type LinkType
 
-	// SourceFiles contains paths to all the .c and .cpp files that have to be compiled.
+	// SourceFiles contains paths to all the .c, .cpp, and .rc files that have to be compiled.
 	SourceFiles []string
 
 	// ObjectPath is the intermediate folder where object files should be stored.
@@ -18,24 +26,30 @@ type Context struct {
 	OutPath string
 
 	// Compiler is an abstract interface used for compiling and linking on multiple platforms.
-	Compiler               Compiler
-	CompilerErrors         int
-	CompilerOptions        *CompilerOptions
-	CompilerWorkerChannel  chan CompilerWorkerTask
-	CompilerWorkerFinished chan int
+	Compiler              Compiler
+	CompilerErrors        atomic.Int32
+	CompilerOptions       *CompilerOptions
+	CompilerWorkerChannel chan CompilerWorkerTask
+	CompilerWorkerGroup   sync.WaitGroup
+
+	// origins contains where the entries in the lists of the compiler options came from, keyed by list name.
+	origins map[string][]string
 }
 
 // NewContext creates a new context with initial values.
-func NewContext() (*Context, error) {
-	compiler, err := getCompiler()
-	if err != nil {
-		return nil, err
-	}
-
+func NewContext(compiler Compiler) *Context {
 	return &Context{
 		Compiler:        compiler,
 		CompilerOptions: &CompilerOptions{},
 
 		SourceFiles: make([]string, 0),
-	}, nil
+	}
+}
+
+// logPrefix returns the prefix to use for log messages that belong to this context's configuration.
+func (ctx *Context) logPrefix() string {
+	if ctx.ConfigurationName == "" {
+		return ""
+	}
+	return "[" + ctx.ConfigurationName + "] "
 }
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codecat/go-libs/log"
+)
+
+// coverageFile is the coverage of a single source file.
+type coverageFile struct {
+	// Path is the path of the source file, relative to the project directory.
+	Path string
+
+	// Lines contains how often each line with code was executed, keyed by line number.
+	Lines map[int]int64
+
+	// Functions contains how often each function was called, keyed by name.
+	Functions map[string]*coverageFunction
+}
+
+// coverageFunction is the coverage of a single function.
+type coverageFunction struct {
+	Line  int
+	Count int64
+}
+
+// coverageSummary is the number of covered lines or functions out of the total.
+type coverageSummary struct {
+	Covered int
+	Total   int
+}
+
+func (s coverageSummary) add(other coverageSummary) coverageSummary {
+	return coverageSummary{s.Covered + other.Covered, s.Total + other.Total}
+}
+
+func (s coverageSummary) String() string {
+	if s.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d (%.1f%%)", s.Covered, s.Total, float64(s.Covered)*100/float64(s.Total))
+}
+
+// lineSummary returns how many lines with code were executed.
+func (file *coverageFile) lineSummary() coverageSummary {
+	ret := coverageSummary{Total: len(file.Lines)}
+	for _, count := range file.Lines {
+		if count > 0 {
+			ret.Covered++
+		}
+	}
+	return ret
+}
+
+// functionSummary returns how many functions were called.
+func (file *coverageFile) functionSummary() coverageSummary {
+	ret := coverageSummary{Total: len(file.Functions)}
+	for _, function := range file.Functions {
+		if function.Count > 0 {
+			ret.Covered++
+		}
+	}
+	return ret
+}
+
+// coverageFlags returns the flags that build with coverage instrumentation, for both compiling and linking.
+func coverageFlags(family string) []string {
+	if family == "clang" {
+		return []string{"-fprofile-instr-generate", "-fcoverage-mapping"}
+	}
+	return []string{"--coverage"}
+}
+
+// coverageEnv returns the environment variables that make an instrumented executable write its coverage data to the
+// object directory. gcc always writes the data next to the object files, so it needs none.
+func coverageEnv(family, objDir string) []string {
+	if family == "clang" {
+		return []string{"LLVM_PROFILE_FILE=" + filepath.Join(objDir, "qb-%p.profraw")}
+	}
+	return nil
+}
+
+// collectCoverage collects the coverage data that an instrumented executable left in the object directory, using
+// gcov for gcc and llvm-cov for clang.
+func collectCoverage(family string, cc []string, objDir, exePath string) ([]*coverageFile, error) {
+	if family == "clang" {
+		return collectLLVMCoverage(cc, objDir, exePath)
+	}
+	return collectGcovCoverage(cc, objDir)
+}
+
+// gcovReport is the part of the JSON output of "gcov --json-format" that we use.
+type gcovReport struct {
+	CurrentWorkingDirectory string `json:"current_working_directory"`
+	Files                   []struct {
+		File  string `json:"file"`
+		Lines []struct {
+			LineNumber int   `json:"line_number"`
+			Count      int64 `json:"count"`
+		} `json:"lines"`
+		Functions []struct {
+			Name           string `json:"name"`
+			DemangledName  string `json:"demangled_name"`
+			StartLine      int    `json:"start_line"`
+			ExecutionCount int64  `json:"execution_count"`
+		} `json:"functions"`
+	} `json:"files"`
+}
+
+// collectGcovCoverage collects the .gcda files that gcc's instrumentation writes next to the object files.
+func collectGcovCoverage(cc []string, objDir string) ([]*coverageFile, error) {
+	gcov := companionTool("gcc", cc, "gcov")
+	if gcov == "" {
+		return nil, errors.New("couldn't find gcov in the PATH")
+	}
+
+	dataFiles, err := findFiles(objDir, ".gcda")
+	if err != nil {
+		return nil, err
+	}
+	if len(dataFiles) == 0 {
+		return nil, errors.New("the program didn't write any coverage data")
+	}
+
+	cmd := exec.Command(gcov, append([]string{"--json-format", "--stdout"}, dataFiles...)...)
+	cmd.Dir = objDir
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gcov failed: %w", err)
+	}
+
+	// gcov prints a separate JSON document for each data file
+	files := make(map[string]*coverageFile)
+	dec := json.NewDecoder(strings.NewReader(string(output)))
+	for {
+		var report gcovReport
+		err := dec.Decode(&report)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("unable to read the output of gcov: %w", err)
+		}
+
+		for _, reportFile := range report.Files {
+			path := reportFile.File
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(report.CurrentWorkingDirectory, path)
+			}
+			file := coverageFileFor(files, path)
+			for _, line := range reportFile.Lines {
+				file.Lines[line.LineNumber] += line.Count
+			}
+			for _, function := range reportFile.Functions {
+				name := function.DemangledName
+				if name == "" {
+					name = function.Name
+				}
+				file.addFunction(name, function.StartLine, function.ExecutionCount)
+			}
+		}
+	}
+	return projectCoverage(files), nil
+}
+
+// collectLLVMCoverage merges the .profraw files that clang's instrumentation writes, and exports the coverage of the
+// executable as LCOV.
+func collectLLVMCoverage(cc []string, objDir, exePath string) ([]*coverageFile, error) {
+	profdata, err := llvmTool(cc, "llvm-profdata")
+	if err != nil {
+		return nil, err
+	}
+	cov, err := llvmTool(cc, "llvm-cov")
+	if err != nil {
+		return nil, err
+	}
+
+	rawFiles, err := findFiles(objDir, ".profraw")
+	if err != nil {
+		return nil, err
+	}
+	if len(rawFiles) == 0 {
+		return nil, errors.New("the program didn't write any coverage data")
+	}
+
+	mergedPath := filepath.Join(objDir, "qb.profdata")
+	args := append([]string{"merge", "-sparse", "-o", mergedPath}, rawFiles...)
+	output, err := exec.Command(profdata[0], append(profdata[1:], args...)...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("llvm-profdata failed: %s", strings.TrimSpace(string(output)))
+	}
+
+	args = []string{"export", "-format=lcov", "-instr-profile=" + mergedPath, exePath}
+	output, err = exec.Command(cov[0], append(cov[1:], args...)...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("llvm-cov failed: %w", err)
+	}
+
+	files, err := parseLcov(strings.NewReader(string(output)))
+	if err != nil {
+		return nil, err
+	}
+	return projectCoverage(files), nil
+}
+
+// llvmTool returns the command of an LLVM tool that comes with clang. On macOS, the tools are found through xcrun.
+func llvmTool(cc []string, name string) ([]string, error) {
+	if tool := companionTool("clang", cc, name); tool != "" {
+		return []string{tool}, nil
+	}
+	if _, err := exec.LookPath("xcrun"); err == nil && runtime.GOOS == "darwin" {
+		return []string{"xcrun", name}, nil
+	}
+	return nil, fmt.Errorf("couldn't find %s in the PATH", name)
+}
+
+// findFiles returns the paths of all files in a directory and its sub-directories that have the given extension.
+func findFiles(dir, ext string) ([]string, error) {
+	ret := make([]string, 0)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && filepath.Ext(path) == ext {
+			ret = append(ret, path)
+		}
+		return nil
+	})
+	return ret, err
+}
+
+// coverageFileFor returns the coverage of a source file, adding it to the map if it's not there yet.
+func coverageFileFor(files map[string]*coverageFile, path string) *coverageFile {
+	file, ok := files[path]
+	if !ok {
+		file = &coverageFile{
+			Path:      path,
+			Lines:     make(map[int]int64),
+			Functions: make(map[string]*coverageFunction),
+		}
+		files[path] = file
+	}
+	return file
+}
+
+// addFunction adds calls of a function. Inline functions in headers are reported once for each object file.
+func (file *coverageFile) addFunction(name string, line int, count int64) {
+	if function, ok := file.Functions[name]; ok {
+		function.Count += count
+		return
+	}
+	file.Functions[name] = &coverageFunction{Line: line, Count: count}
+}
+
+// projectCoverage returns the coverage of the source files in the project directory, sorted by path. Files outside
+// of it, like system headers, are left out.
+func projectCoverage(files map[string]*coverageFile) []*coverageFile {
+	currentDir, _ := filepath.Abs(".")
+
+	ret := make([]*coverageFile, 0)
+	for path, file := range files {
+		relPath, err := filepath.Rel(currentDir, path)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+		file.Path = filepath.ToSlash(relPath)
+		ret = append(ret, file)
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Path < ret[j].Path
+	})
+	return ret
+}
+
+// parseLcov reads coverage in the LCOV tracefile format, keyed by the absolute path of each source file.
+func parseLcov(r io.Reader) (map[string]*coverageFile, error) {
+	files := make(map[string]*coverageFile)
+	var file *coverageFile
+	functionLines := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		key, value, _ := strings.Cut(scanner.Text(), ":")
+		switch key {
+		case "SF":
+			path, _ := filepath.Abs(value)
+			file = coverageFileFor(files, path)
+			clear(functionLines)
+
+		case "FN":
+			// FN:<line>,<name>
+			line, name, _ := strings.Cut(value, ",")
+			functionLines[name], _ = strconv.Atoi(line)
+
+		case "FNDA":
+			// FNDA:<count>,<name>
+			count, name, _ := strings.Cut(value, ",")
+			if file != nil {
+				n, _ := strconv.ParseInt(count, 10, 64)
+				file.addFunction(name, functionLines[name], n)
+			}
+
+		case "DA":
+			// DA:<line>,<count>[,<checksum>]
+			parts := strings.Split(value, ",")
+			if file != nil && len(parts) >= 2 {
+				line, _ := strconv.Atoi(parts[0])
+				count, _ := strconv.ParseInt(parts[1], 10, 64)
+				file.Lines[line] += count
+			}
+
+		case "end_of_record":
+			file = nil
+		}
+	}
+	return files, scanner.Err()
+}
+
+// printCoverage prints a summary of the coverage of each file.
+func printCoverage(files []*coverageFile) {
+	var lines, functions coverageSummary
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "File\tLines\tFunctions\n")
+	for _, file := range files {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", file.Path, file.lineSummary(), file.functionSummary())
+		lines = lines.add(file.lineSummary())
+		functions = functions.add(file.functionSummary())
+	}
+	fmt.Fprintf(w, "Total\t%s\t%s\n", lines, functions)
+	w.Flush()
+}
+
+// writeLcov writes coverage in the LCOV tracefile format, which most editors and coverage services can read.
+func writeLcov(path string, files []*coverageFile) error {
+	var sb strings.Builder
+	for _, file := range files {
+		fmt.Fprintf(&sb, "SF:%s\n", file.Path)
+
+		for _, name := range sortedFunctions(file) {
+			fmt.Fprintf(&sb, "FN:%d,%s\n", file.Functions[name].Line, name)
+		}
+		for _, name := range sortedFunctions(file) {
+			fmt.Fprintf(&sb, "FNDA:%d,%s\n", file.Functions[name].Count, name)
+		}
+		functions := file.functionSummary()
+		fmt.Fprintf(&sb, "FNF:%d\nFNH:%d\n", functions.Total, functions.Covered)
+
+		for _, line := range sortedLines(file) {
+			fmt.Fprintf(&sb, "DA:%d,%d\n", line, file.Lines[line])
+		}
+		lines := file.lineSummary()
+		fmt.Fprintf(&sb, "LF:%d\nLH:%d\n", lines.Total, lines.Covered)
+
+		sb.WriteString("end_of_record\n")
+	}
+	return os.WriteFile(path, []byte(sb.String()), 0666)
+}
+
+// sortedFunctions returns the names of the functions in a file, in the order in which they appear.
+func sortedFunctions(file *coverageFile) []string {
+	ret := make([]string, 0, len(file.Functions))
+	for name := range file.Functions {
+		ret = append(ret, name)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		a, b := file.Functions[ret[i]], file.Functions[ret[j]]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return ret[i] < ret[j]
+	})
+	return ret
+}
+
+// sortedLines returns the numbers of the lines with code in a file, in order.
+func sortedLines(file *coverageFile) []int {
+	ret := make([]int, 0, len(file.Lines))
+	for line := range file.Lines {
+		ret = append(ret, line)
+	}
+	sort.Ints(ret)
+	return ret
+}
+
+// coverageHTMLTemplate is the template of the HTML report, which shows a summary and the source of each file.
+var coverageHTMLTemplate = template.Must(template.New("coverage").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Coverage</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { padding: 0.25em 1em; text-align: left; border-bottom: 1px solid #ddd; }
+pre { line-height: 1.3; }
+.hit { background: #dfd; }
+.miss { background: #fdd; }
+.count { color: #888; }
+</style>
+</head>
+<body>
+<h1>Coverage</h1>
+<table>
+<tr><th>File</th><th>Lines</th><th>Functions</th></tr>
+{{range $i, $file := .Files}}<tr><td><a href="#file{{$i}}">{{$file.Path}}</a></td><td>{{$file.Lines}}</td><td>{{$file.Functions}}</td></tr>
+{{end}}<tr><th>Total</th><th>{{.Lines}}</th><th>{{.Functions}}</th></tr>
+</table>
+{{range $i, $file := .Files}}
+<h2 id="file{{$i}}">{{$file.Path}}</h2>
+<pre>{{range $file.Source}}<span class="{{.Class}}"><span class="count">{{printf "%5d %8s" .Number .Count}}</span>  {{.Text}}</span>
+{{end}}</pre>
+{{end}}
+</body>
+</html>
+`))
+
+// writeCoverageHTML writes a report of the coverage as a single HTML file.
+func writeCoverageHTML(path string, files []*coverageFile) error {
+	type sourceLine struct {
+		Number int
+		Count  string
+		Class  string
+		Text   string
+	}
+	type fileReport struct {
+		Path      string
+		Lines     coverageSummary
+		Functions coverageSummary
+		Source    []sourceLine
+	}
+
+	report := struct {
+		Files     []fileReport
+		Lines     coverageSummary
+		Functions coverageSummary
+	}{}
+
+	for _, file := range files {
+		fr := fileReport{
+			Path:      file.Path,
+			Lines:     file.lineSummary(),
+			Functions: file.functionSummary(),
+		}
+		report.Lines = report.Lines.add(fr.Lines)
+		report.Functions = report.Functions.add(fr.Functions)
+
+		source, err := os.ReadFile(file.Path)
+		if err != nil {
+			log.Warn("Unable to read %s for the coverage report: %s", file.Path, err.Error())
+		}
+		for i, text := range strings.Split(strings.TrimSuffix(string(source), "\n"), "\n") {
+			line := sourceLine{Number: i + 1, Text: strings.TrimRight(text, "\r")}
+			if count, ok := file.Lines[i+1]; ok {
+				line.Count = strconv.FormatInt(count, 10)
+				line.Class = "miss"
+				if count > 0 {
+					line.Class = "hit"
+				}
+			}
+			fr.Source = append(fr.Source, line)
+		}
+
+		report.Files = append(report.Files, fr)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return coverageHTMLTemplate.Execute(f, report)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseLcov(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  map[string]*coverageFile
+	}{
+		{
+			name:  "empty",
+			input: "",
+			want:  map[string]*coverageFile{},
+		},
+		{
+			name: "single file",
+			input: "TN:\nSF:/src/main.c\nFN:3,main\nFN:9,unused\nFNDA:1,main\nFNDA:0,unused\nFNF:2\nFNH:1\n" +
+				"DA:3,1\nDA:4,1\nDA:9,0\nLF:3\nLH:2\nend_of_record\n",
+			want: map[string]*coverageFile{
+				"/src/main.c": {
+					Path:  "/src/main.c",
+					Lines: map[int]int64{3: 1, 4: 1, 9: 0},
+					Functions: map[string]*coverageFunction{
+						"main":   {Line: 3, Count: 1},
+						"unused": {Line: 9, Count: 0},
+					},
+				},
+			},
+		},
+		{
+			name: "records of the same file are added up",
+			input: "SF:/src/util.h\nFN:2,inc\nFNDA:2,inc\nDA:2,2\nend_of_record\n" +
+				"SF:/src/util.h\nFN:2,inc\nFNDA:3,inc\nDA:2,3\nDA:5,0\nend_of_record\n",
+			want: map[string]*coverageFile{
+				"/src/util.h": {
+					Path:      "/src/util.h",
+					Lines:     map[int]int64{2: 5, 5: 0},
+					Functions: map[string]*coverageFunction{"inc": {Line: 2, Count: 5}},
+				},
+			},
+		},
+		{
+			name:  "line checksums are ignored",
+			input: "SF:/src/a.c\nDA:1,4,abcdef\nend_of_record\n",
+			want: map[string]*coverageFile{
+				"/src/a.c": {
+					Path:      "/src/a.c",
+					Lines:     map[int]int64{1: 4},
+					Functions: map[string]*coverageFunction{},
+				},
+			},
+		},
+		{
+			name:  "records outside of a file are ignored",
+			input: "DA:1,1\nFNDA:1,main\nSF:/src/b.c\nDA:2,1\nend_of_record\nDA:3,1\n",
+			want: map[string]*coverageFile{
+				"/src/b.c": {
+					Path:      "/src/b.c",
+					Lines:     map[int]int64{2: 1},
+					Functions: map[string]*coverageFunction{},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseLcov(strings.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The paths are made absolute, which only changes them on Windows
+			want := make(map[string]*coverageFile)
+			for path, file := range test.want {
+				abs, _ := filepath.Abs(path)
+				file.Path = abs
+				want[abs] = file
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteLcov(t *testing.T) {
+	files := []*coverageFile{
+		{
+			Path:  "src/main.c",
+			Lines: map[int]int64{4: 1, 3: 1, 9: 0},
+			Functions: map[string]*coverageFunction{
+				"unused": {Line: 9, Count: 0},
+				"main":   {Line: 3, Count: 1},
+			},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "lcov.info")
+	if err := writeLcov(path, files); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "SF:src/main.c\nFN:3,main\nFN:9,unused\nFNDA:1,main\nFNDA:0,unused\nFNF:2\nFNH:1\n" +
+		"DA:3,1\nDA:4,1\nDA:9,0\nLF:3\nLH:2\nend_of_record\n"
+	if string(data) != want {
+		t.Errorf("got:\n%s\nwant:\n%s", data, want)
+	}
+}
+
+func TestCoverageSummary(t *testing.T) {
+	tests := []struct {
+		summary coverageSummary
+		want    string
+	}{
+		{coverageSummary{0, 0}, "-"},
+		{coverageSummary{0, 4}, "0/4 (0.0%)"},
+		{coverageSummary{1, 3}, "1/3 (33.3%)"},
+		{coverageSummary{2, 2}, "2/2 (100.0%)"},
+	}
+
+	for _, test := range tests {
+		if got := test.summary.String(); got != test.want {
+			t.Errorf("%+v.String() = %q, want %q", test.summary, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// toolchainDetail is a detail about a toolchain, such as the command it uses for linking, as shown by "qb doctor".
+type toolchainDetail struct {
+	Name   string
+	Values []string
+}
+
+// doctorTest is a tiny program that "qb doctor" builds to check whether the toolchain works.
+type doctorTest struct {
+	language string
+	filename string
+	source   string
+}
+
+var doctorTests = []doctorTest{
+	{"C", "doctor.c", "#include <stdio.h>\nint main(void) { printf(\"qb\\n\"); return 0; }\n"},
+	{"C++", "doctor.cpp", "#include <string>\nint main() { std::string s = \"qb\"; return s.size() == 2 ? 0 : 1; }\n"},
+}
+
+func commandDoctor(args []string) int {
+	if !noArguments("doctor", args) {
+		return 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+
+	problems := 0
+	check := func(name string, err error) {
+		if err != nil {
+			problems++
+			fmt.Fprintf(w, "  %s\tFAILED\n", name)
+			for _, line := range strings.Split(strings.TrimSpace(err.Error()), "\n") {
+				fmt.Fprintf(w, "    %s\n", line)
+			}
+			return
+		}
+		fmt.Fprintf(w, "  %s\tok\n", name)
+	}
+
+	// summarize prints the number of problems we found and returns the exit code
+	summarize := func() int {
+		w.Flush()
+		if problems > 0 {
+			fmt.Printf("\n😢 Found %d problem(s)!\n", problems)
+			return 1
+		}
+		fmt.Printf("\n👏 No problems found\n")
+		return 0
+	}
+
+	fmt.Fprintf(w, "System\n")
+	fmt.Fprintf(w, "  host\t%s/%s\n", runtime.GOOS, runtime.GOARCH)
+	check("configuration", loadConfig())
+
+	toolchain = newToolchainOptions()
+	if toolchain.Toolset != "" {
+		fmt.Fprintf(w, "  toolset\t%s\n", toolchain.Toolset)
+	}
+	if toolchain.Target != "" {
+		fmt.Fprintf(w, "  target\t%s\n", toolchain.Target)
+	}
+	if toolchain.Sysroot != "" {
+		fmt.Fprintf(w, "  sysroot\t%s\n", toolchain.Sysroot)
+	}
+
+	fmt.Fprintf(w, "\nCompilers in the PATH\n")
+	compilers := availableCompilers()
+	if len(compilers) == 0 {
+		fmt.Fprintf(w, "  (none)\t\n")
+	}
+	for _, path := range compilers {
+		info, err := detectCompiler([]string{path})
+		if err != nil {
+			fmt.Fprintf(w, "  %s\tunable to run\n", path)
+			continue
+		}
+		fmt.Fprintf(w, "  %s\t%s %s\n", path, info.family, info.version)
+	}
+
+	fmt.Fprintf(w, "\nTools\n")
+	for _, tool := range []string{"pkg-config", "conan"} {
+		fmt.Fprintf(w, "  %s\t%s\n", tool, toolVersion(tool))
+	}
+
+	fmt.Fprintf(w, "\nSelected toolchain\n")
+	compiler, err := findCompiler(toolchain)
+	if err != nil {
+		check("compiler", err)
+		for _, hint := range compilerHints() {
+			fmt.Fprintf(w, "    %s\n", hint)
+		}
+		return summarize()
+	}
+	fmt.Fprintf(w, "  toolset\t%s %s\n", compiler.Toolset(), compiler.Version())
+	for _, detail := range compiler.Details() {
+		if len(detail.Values) == 0 {
+			fmt.Fprintf(w, "  %s\t(none)\n", detail.Name)
+		}
+		for i, value := range detail.Values {
+			if i == 0 {
+				fmt.Fprintf(w, "  %s\t%s\n", detail.Name, value)
+			} else {
+				fmt.Fprintf(w, "  \t%s\n", value)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "\nTest builds\n")
+	tempDir, err := os.MkdirTemp("", "qb_doctor_")
+	if err != nil {
+		check("temporary directory", err)
+		return summarize()
+	}
+	defer os.RemoveAll(tempDir)
+
+	for _, test := range doctorTests {
+		for _, outType := range []LinkType{LinkExe, LinkDll, LinkLib} {
+			name := fmt.Sprintf("%s %s", test.language, outType)
+			check(name, doctorBuild(compiler, tempDir, test, outType))
+		}
+	}
+
+	return summarize()
+}
+
+// doctorBuild compiles and links a test program into an output of the given type. Executables are also run, unless
+// we are cross-compiling.
+func doctorBuild(compiler Compiler, tempDir string, test doctorTest, outType LinkType) error {
+	dir := filepath.Join(tempDir, strings.ReplaceAll(test.language, "+", "p")+"_"+outType.String())
+	objDir := filepath.Join(dir, "obj")
+	err := os.MkdirAll(objDir, 0777)
+	if err != nil {
+		return err
+	}
+
+	sourcePath := filepath.Join(dir, test.filename)
+	err = os.WriteFile(sourcePath, []byte(test.source), 0666)
+	if err != nil {
+		return err
+	}
+
+	options := &CompilerOptions{
+		Languages: sourceLanguages([]string{sourcePath}),
+	}
+	err = compiler.Compile(sourcePath, objDir, options)
+	if err != nil {
+		return err
+	}
+
+	outPath, err := compiler.Link(objDir, filepath.Join(dir, "doctor"), outType, options)
+	if err != nil {
+		return err
+	}
+
+	if outType != LinkExe || toolchain.Target != "" {
+		return nil
+	}
+
+	output, err := exec.Command(outPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("the program doesn't run: %w\n%s", err, output)
+	}
+	return nil
+}
+
+var compilerNamePattern = regexp.MustCompile(`^((.+-)?(clang|gcc)(-[0-9.]+)?|cl)(\.exe)?$`)
+
+// availableCompilers returns the paths of all C compilers that can be found in the PATH, including versioned and
+// cross-compilers like "gcc-13" or "aarch64-linux-gnu-gcc".
+func availableCompilers() []string {
+	ret := make([]string, 0)
+	names := make([]string, 0)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !compilerNamePattern.MatchString(name) || slices.Contains(names, name) {
+				continue
+			}
+			names = append(names, name)
+			ret = append(ret, filepath.Join(dir, name))
+		}
+	}
+	return ret
+}
+
+// toolVersion returns the version of a tool if it can be found in the PATH, or "not found".
+func toolVersion(name string) string {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "not found"
+	}
+
+	output, err := exec.Command(path, "--version").Output()
+	if err != nil {
+		return path
+	}
+	firstLine, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return fmt.Sprintf("%s (%s)", path, strings.TrimSpace(firstLine))
+}
+
+// compilerHints returns suggestions on how to make a compiler available on this system.
+func compilerHints() []string {
+	switch runtime.GOOS {
+	case "windows":
+		return []string{
+			"Install Visual Studio or the Build Tools for Visual Studio with the \"Desktop development with C++\"",
+			"workload, or install MinGW-w64 and use --toolset mingw.",
+		}
+	case "darwin":
+		return []string{
+			"Install the Xcode command line tools with \"xcode-select --install\".",
+		}
+	}
+	return []string{
+		"Install clang or gcc with your package manager (for example \"apt install build-essential\"),",
+		"or point the CC and CXX environment variables or --toolset at your compiler.",
+	}
+}
+
+// gccSearchDirs returns the default include and library directories of a gcc style compiler.
+func gccSearchDirs(cxx []string, args []string) ([]string, []string) {
+	includes := make([]string, 0)
+	libs := make([]string, 0)
+
+	// The include directories are printed between these lines when preprocessing verbosely
+	cmd := exec.Command(cxx[0], slices.Concat(cxx[1:], args, []string{"-E", "-x", "c++", "-", "-v"})...)
+	output, _ := cmd.CombinedOutput()
+	inList := false
+	for _, line := range strings.Split(string(output), "\n") {
+		switch {
+		case strings.HasPrefix(line, "#include <...> search starts here:"):
+			inList = true
+		case strings.HasPrefix(line, "End of search list."):
+			inList = false
+		case inList:
+			includes = append(includes, filepath.Clean(strings.TrimSuffix(strings.TrimSpace(line), " (framework directory)")))
+		}
+	}
+
+	cmd = exec.Command(cxx[0], slices.Concat(cxx[1:], args, []string{"-print-search-dirs"})...)
+	output, _ = cmd.Output()
+	for _, line := range strings.Split(string(output), "\n") {
+		dirs, ok := strings.CutPrefix(line, "libraries: =")
+		if !ok {
+			continue
+		}
+		for _, dir := range filepath.SplitList(dirs) {
+			dir = filepath.Clean(dir)
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() || slices.Contains(libs, dir) {
+				continue
+			}
+			libs = append(libs, dir)
+		}
+	}
+
+	return includes, libs
+}
+
+// gccLinker returns the linker that a gcc style compiler uses.
+func gccLinker(cc []string, args []string) string {
+	cmd := exec.Command(cc[0], slices.Concat(cc[1:], args, []string{"-print-prog-name=ld"})...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "unknown"
+	}
+	linker := strings.TrimSpace(string(output))
+	if path, err := exec.LookPath(linker); err == nil {
+		return path
+	}
+	return linker
+}
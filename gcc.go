@@ -0,0 +1,378 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/codecat/go-libs/log"
+)
+
+// gccCompiler compiles and links with gcc or clang, using the same command line options as gcc. It's embedded by the
+// compilers of the platforms that use it, which add what is specific to their binaries.
+type gccCompiler struct {
+	// cc and cxx are the commands that invoke the C and C++ compilers.
+	cc  []string
+	cxx []string
+
+	// caps contains what the compiler supports.
+	caps *compilerCapabilities
+
+	// ar is the command that creates static libraries, and ltoAr is the one that is used with link-time
+	// optimization.
+	ar    string
+	ltoAr string
+
+	// targetArgs are the arguments that make the compiler build for the target, like --target and --sysroot.
+	targetArgs []string
+}
+
+// gccTargetArgs returns the arguments that make a compiler build for the target. A gcc toolchain for the target is
+// already selected when the compiler is found, so only clang needs to be told about the target.
+func gccTargetArgs(family, target, sysroot string) []string {
+	args := make([]string, 0)
+	if target != "" && family == "clang" {
+		args = append(args, "--target="+target)
+	}
+	if sysroot != "" {
+		args = append(args, "--sysroot="+sysroot)
+	}
+	return args
+}
+
+// command creates a command that invokes a compiler with the given arguments.
+func (ci gccCompiler) command(compiler []string, args []string) *exec.Cmd {
+	return exec.Command(compiler[0], slices.Concat(compiler[1:], args)...)
+}
+
+// run runs a command of the toolchain and returns its output as an error if it fails.
+func (ci gccCompiler) run(cmd *exec.Cmd, options *CompilerOptions) error {
+	if options.Verbose {
+		log.Trace("%s", strings.Join(cmd.Args, " "))
+	}
+
+	outputBytes, err := cmd.CombinedOutput()
+	if err != nil {
+		output := strings.Trim(string(outputBytes), "\r\n")
+		return errors.New(output)
+	}
+	return nil
+}
+
+// pgoArgs returns the arguments for profile-guided optimization.
+func (ci gccCompiler) pgoArgs(options *CompilerOptions) []string {
+	switch {
+	case options.PGO == PGOGenerate:
+		return []string{"-fprofile-generate=" + options.ProfilePath}
+	case options.PGO == PGOUse && ci.caps.family == "clang":
+		return []string{"-fprofile-use=" + filepath.Join(options.ProfilePath, "merged.profdata")}
+	case options.PGO == PGOUse:
+		// Sources that were added since the profiles were collected have no profile, which is fine
+		return []string{"-fprofile-use=" + options.ProfilePath, "-Wno-missing-profile"}
+	}
+	return nil
+}
+
+// hardenArgs returns the compiler arguments that harden the code against exploits. -fPIC is used instead of -fPIE,
+// as it also works for shared libraries. Protections that depend on the compiler and target, like Intel CET, are
+// only used if the compiler supports them.
+func (ci gccCompiler) hardenArgs(options *CompilerOptions) []string {
+	args := []string{"-fPIC", "-fstack-protector-strong"}
+
+	// _FORTIFY_SOURCE only works when optimizing, and some distributions already define it
+	if options.Optimization == OptimizeSize || options.Optimization == OptimizeSpeed {
+		args = append(args, "-U_FORTIFY_SOURCE", "-D_FORTIFY_SOURCE=2")
+	}
+
+	for _, flag := range []string{"-fstack-clash-protection", "-fcf-protection=full"} {
+		if ci.caps.supportsFlag("c", flag) {
+			args = append(args, flag)
+		}
+	}
+	return args
+}
+
+// debugArgs returns the arguments that change how debug information is produced, for both compiling and linking.
+// dwp can't always read compressed .dwo files, so with split DWARF only the .debug file is compressed.
+func (ci gccCompiler) debugArgs(options *CompilerOptions) []string {
+	if options.SplitDWARF {
+		return []string{"-gsplit-dwarf"}
+	}
+	if options.CompressDebug {
+		return []string{"-gz"}
+	}
+	return nil
+}
+
+func (ci gccCompiler) Compile(path, objDir string, options *CompilerOptions) error {
+	fileext := filepath.Ext(path)
+	filename := strings.TrimSuffix(filepath.Base(path), fileext)
+
+	language := "c++"
+	if fileext == ".c" {
+		language = "c"
+	}
+
+	args := make([]string, 0)
+	args = append(args, "-c")
+	args = append(args, "-o", filepath.Join(objDir, filename+".o"))
+	args = append(args, gccPCHArgs(ci.caps.family, language, options)...)
+	return ci.compile(path, language, args, options)
+}
+
+func (ci gccCompiler) CompileHeader(header, language string, options *CompilerOptions) error {
+	path, err := writePCHSource(options, language, filepath.Base(header))
+	if err != nil {
+		return err
+	}
+
+	args := make([]string, 0)
+	args = append(args, "-x", language+"-header")
+	args = append(args, "-o", gccPCHOutput(ci.caps.family, language, options))
+	return ci.compile(path, language, args, options)
+}
+
+// compile compiles a source file or header of the given language, either "c" or "c++". The arguments decide what it
+// is compiled into.
+func (ci gccCompiler) compile(path, language string, args []string, options *CompilerOptions) error {
+	args = append(args, ci.targetArgs...)
+
+	// Set warnings flags
+	if options.Strict {
+		args = append(args, "-Wall")
+		args = append(args, "-Wextra")
+		args = append(args, "-Werror")
+	}
+
+	// Set debug flag
+	if options.debugSymbols() {
+		args = append(args, "-g")
+		args = append(args, ci.debugArgs(options)...)
+	}
+
+	// Add optimization flags
+	if options.Optimization == OptimizeSize {
+		args = append(args, "-Os")
+	} else if options.Optimization == OptimizeSpeed {
+		args = append(args, "-O3")
+	}
+
+	// Add hardening flags
+	if options.Harden {
+		args = append(args, ci.hardenArgs(options)...)
+	}
+
+	// Add the language standard flag, as far as the compiler supports it
+	if language == "c" {
+		if flag := ci.caps.cStandardFlag(options.CStandard); flag != "" {
+			args = append(args, flag)
+		}
+	} else {
+		if flag := ci.caps.cppStandardFlag(options.CPPStandard); flag != "" {
+			args = append(args, flag)
+		}
+	}
+
+	// Select the C++ standard library
+	if language != "c" && options.StdLib != StdLibDefault {
+		args = append(args, "-stdlib="+options.StdLib.String())
+	}
+
+	// Enable link-time optimization
+	if flag := ci.caps.ltoFlag(options.LTO); flag != "" {
+		args = append(args, flag)
+	}
+
+	// Add sanitizers, which need frame pointers and debug information for useful reports
+	if flag := sanitizeFlag(options.Sanitize); flag != "" {
+		args = append(args, flag, "-fno-omit-frame-pointer")
+		if !options.debugSymbols() {
+			args = append(args, "-g")
+		}
+	}
+
+	// Add coverage instrumentation
+	if options.Coverage {
+		args = append(args, coverageFlags(ci.caps.family)...)
+	}
+
+	// Add profile-guided optimization
+	args = append(args, ci.pgoArgs(options)...)
+
+	// Add include directories
+	for _, dir := range options.IncludeDirectories {
+		args = append(args, "-I"+dir)
+	}
+
+	// Add precompiler definitions
+	for _, define := range options.Defines {
+		args = append(args, "-D"+define)
+	}
+
+	// Add additional compiler flags for C/C++
+	args = append(args, options.CompilerFlagsCXX...)
+
+	// Add additional compiler flags for C++
+	if language != "c" {
+		args = append(args, options.CompilerFlagsCPP...)
+	}
+
+	// Add additional compiler flags for C
+	if language == "c" {
+		args = append(args, options.CompilerFlagsC...)
+	}
+
+	args = append(args, path)
+
+	compiler := ci.cxx
+	if language == "c" {
+		compiler = ci.cc
+	}
+	return ci.run(ci.command(compiler, args), options)
+}
+
+// link links the object files in objDir into outPath, which already has the suffix of the output type. The extra
+// arguments are passed when linking an executable or dynamic library.
+func (ci gccCompiler) link(objDir, outPath string, outType LinkType, options *CompilerOptions, extraArgs []string) error {
+	return ci.run(ci.linkCommand(objDir, outPath, outType, options, extraArgs), options)
+}
+
+// linkCommand creates the command that link runs.
+func (ci gccCompiler) linkCommand(objDir, outPath string, outType LinkType, options *CompilerOptions, extraArgs []string) *exec.Cmd {
+	args := make([]string, 0)
+
+	// Link with the C++ compiler if there are C++ sources, so that it adds the C++ standard library for us
+	cpp := slices.Contains(options.Languages, "c++")
+	linker := ci.cc
+	if cpp {
+		linker = ci.cxx
+	}
+
+	switch outType {
+	case LinkDll:
+		args = append(args, "-shared")
+	case LinkLib:
+		linker = []string{ci.ar}
+		if options.LTO != LTOOff {
+			linker = []string{ci.ltoAr}
+		}
+	}
+
+	if outType == LinkLib {
+		// r = insert with replacement
+		// c = create new archive
+		// s = write an index
+		args = append(args, "rcs")
+		args = append(args, outPath)
+
+	} else {
+		args = append(args, extraArgs...)
+		args = append(args, "-o", outPath)
+		args = append(args, ci.targetArgs...)
+
+		// Don't depend on the shared runtime libraries of gcc, which might not be on the system that runs the binary
+		if ci.caps.family == "gcc" {
+			args = append(args, "-static-libgcc")
+			if cpp {
+				args = append(args, "-static-libstdc++")
+			}
+		}
+
+		// Link with full RELRO and a non-executable stack, as a position independent executable
+		if options.Harden {
+			args = append(args, "-Wl,-z,relro,-z,now", "-Wl,-z,noexecstack")
+			if outType == LinkExe && !options.Static {
+				args = append(args, "-pie")
+			}
+		}
+
+		// Link with the same debug information options, or strip the binary if it shouldn't have any
+		if options.debugSymbols() {
+			args = append(args, ci.debugArgs(options)...)
+		} else if options.DebugInfo == DebugInfoNone {
+			args = append(args, "-s")
+		}
+
+		// Link-time optimization has to be enabled when linking as well
+		if flag := ci.caps.ltoFlag(options.LTO); flag != "" {
+			args = append(args, flag)
+		}
+
+		// The sanitizers need their runtime libraries
+		if flag := sanitizeFlag(options.Sanitize); flag != "" {
+			args = append(args, flag)
+		}
+
+		// Link the coverage runtime
+		if options.Coverage {
+			args = append(args, coverageFlags(ci.caps.family)...)
+		}
+
+		// Link the profiling runtime, or use the profiles when optimizing at link time
+		args = append(args, ci.pgoArgs(options)...)
+
+		// Use a different linker
+		if options.Linker != LinkerDefault {
+			args = append(args, "-fuse-ld="+options.Linker.String())
+		}
+
+		// Link the same C++ standard library that we compiled with
+		if cpp && options.StdLib != StdLibDefault {
+			args = append(args, "-stdlib="+options.StdLib.String())
+		}
+
+		if options.Static {
+			args = append(args, "-static")
+		}
+
+		// Add additional library paths
+		for _, dir := range options.LinkDirectories {
+			args = append(args, "-L"+dir)
+		}
+	}
+
+	filepath.Walk(objDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, ".o") {
+			return nil
+		}
+		args = append(args, path)
+		return nil
+	})
+
+	if outType != LinkLib {
+		// Add libraries to link
+		for _, link := range options.LinkLibraries {
+			args = append(args, "-l"+link)
+		}
+
+		// The static libc++ doesn't pull in its ABI library by itself
+		if cpp && options.Static && options.StdLib == StdLibLibCPP {
+			args = append(args, "-lc++abi")
+		}
+
+		// Add additional linker flags
+		args = append(args, options.LinkerFlags...)
+	}
+
+	return ci.command(linker, args)
+}
+
+// details returns the details of the toolchain that all platforms using gcc have in common.
+func (ci gccCompiler) details() []toolchainDetail {
+	includes, libs := gccSearchDirs(ci.cxx, ci.targetArgs)
+	return []toolchainDetail{
+		{"C compiler", []string{strings.Join(ci.cc, " ")}},
+		{"C++ compiler", []string{strings.Join(ci.cxx, " ")}},
+		{"archiver", []string{ci.ar}},
+		{"LTO archiver", []string{ci.ltoAr}},
+		{"linker", []string{gccLinker(ci.cc, ci.targetArgs)}},
+		{"include dirs", includes},
+		{"library dirs", libs},
+	}
+}
@@ -2,6 +2,46 @@
 
 package main
 
-func getCompiler() (Compiler, error) {
-	return darwinCompiler{}, nil
+import (
+	"os"
+
+	"github.com/mattn/go-shellwords"
+)
+
+func getCompiler(toolchain ToolchainOptions) (Compiler, error) {
+	// Honor the conventional CC and CXX environment variables
+	cc, _ := shellwords.Parse(os.Getenv("CC"))
+	cxx, _ := shellwords.Parse(os.Getenv("CXX"))
+
+	if toolchain.Toolset != "" {
+		// An explicit toolset takes precedence over the environment
+		var err error
+		cc, err = toolsetCommand(toolchain.Toolset, "")
+		if err != nil {
+			return nil, err
+		}
+		cxx = nil
+	} else if len(cc) == 0 {
+		cc = []string{"clang"}
+	}
+
+	if len(cxx) == 0 {
+		cxx = cxxCommand(cc)
+	}
+
+	info, err := detectCompiler(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := darwinCompiler{
+		toolset: info.family,
+		version: info.version,
+		cc:      cc,
+		cxx:     cxx,
+		target:  toolchain.Target,
+		sysroot: toolchain.Sysroot,
+	}
+	ret.caps = newCompilerCapabilities(cc, cxx, info, ret.targetArgs())
+	return ret, nil
 }
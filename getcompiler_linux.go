@@ -4,24 +4,120 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"os"
 	"os/exec"
+
+	"github.com/mattn/go-shellwords"
 )
 
-func getCompiler() (Compiler, error) {
-	//TODO: Check if we have gcc and ld installed
-	//TODO: Add option for other flavors of gcc (eg. mingw)
+func getCompiler(toolchain ToolchainOptions) (Compiler, error) {
+	// Honor the conventional CC and CXX environment variables
+	cc, _ := shellwords.Parse(os.Getenv("CC"))
+	cxx, _ := shellwords.Parse(os.Getenv("CXX"))
+
+	target := toolchain.Target
+	ccFromEnv := false
+
+	switch {
+	case toolchain.Toolset != "":
+		// An explicit toolset takes precedence over the environment
+		var err error
+		cc, err = toolsetCommand(toolchain.Toolset, target)
+		if err != nil {
+			return nil, err
+		}
+		cxx = nil
+
+	case len(cc) > 0:
+		// Use the compilers from the environment
+		ccFromEnv = true
+
+	case target != "":
+		// Prefer a gcc toolchain for the target, as it comes with the libraries of the target
+		if _, err := exec.LookPath(target + "-gcc"); err == nil {
+			cc = []string{target + "-gcc"}
+		} else if _, err := exec.LookPath("clang"); err == nil {
+			cc = []string{"clang"}
+		} else {
+			return nil, fmt.Errorf("couldn't find %s-gcc or clang in the PATH", target)
+		}
+
+	default:
+		if _, err := exec.LookPath("clang"); err == nil {
+			cc = []string{"clang"}
+		} else if _, err := exec.LookPath("gcc"); err == nil {
+			cc = []string{"gcc"}
+		} else {
+			return nil, errors.New("couldn't find clang or gcc in the PATH")
+		}
+	}
+
+	if len(cxx) == 0 {
+		cxx = cxxCommand(cc)
+	}
+
+	info, err := detectCompiler(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	// The compilers from the environment are usually meant for the host
+	if ccFromEnv {
+		if err := checkCompilerTarget(cc, info, target); err != nil {
+			return nil, fmt.Errorf("CC doesn't match the target: %w", err)
+		}
+	}
 
-	toolset := ""
+	ar := findArchiver(info.family, target)
+	targetArgs := gccTargetArgs(info.family, target, toolchain.Sysroot)
+	ret := linuxCompiler{
+		gccCompiler: gccCompiler{
+			cc:         cc,
+			cxx:        cxx,
+			caps:       newCompilerCapabilities(cc, cxx, info, targetArgs),
+			ar:         ar,
+			ltoAr:      ltoArchiver(info.family, cc, ar),
+			targetArgs: targetArgs,
+		},
+		toolset: info.family,
+		version: info.version,
+		objcopy: findBinutil(info.family, target, "objcopy"),
+		dwp:     findDwp(info.family, target),
+		target:  target,
+	}
+	return ret, nil
+}
 
-	if _, err := exec.LookPath("clang"); err == nil {
-		toolset = "clang"
-	} else if _, err := exec.LookPath("gcc"); err == nil {
-		toolset = "gcc"
-	} else {
-		return nil, errors.New("couldn't find clang or gcc in the PATH")
+// findArchiver returns the command that creates static libraries for the target. The AR environment variable is
+// honored.
+func findArchiver(toolset, target string) string {
+	if ar := os.Getenv("AR"); ar != "" {
+		return ar
 	}
+	return findBinutil(toolset, target, "ar")
+}
 
-	return linuxCompiler{
-		toolset: toolset,
-	}, nil
+// findBinutil returns the command of a binutils tool for the target, like "ar" or "objcopy". When cross-compiling we
+// look for the binutils of the target, or the LLVM version of the tool for clang.
+func findBinutil(toolset, target, name string) string {
+	if target == "" {
+		return name
+	}
+	if _, err := exec.LookPath(target + "-" + name); err == nil {
+		return target + "-" + name
+	}
+	if _, err := exec.LookPath("llvm-" + name); err == nil && toolset == "clang" {
+		return "llvm-" + name
+	}
+	return name
+}
+
+// findDwp returns the command that packages .dwo files into a .dwp file. llvm-dwp is preferred, as the dwp of binutils
+// can't handle DWARF 5, which gcc produces by default since version 11.
+func findDwp(toolset, target string) string {
+	if _, err := exec.LookPath("llvm-dwp"); err == nil {
+		return "llvm-dwp"
+	}
+	return findBinutil(toolset, target, "dwp")
 }
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// defaultMingwTarget is the target triple that is used for MinGW if no target is given.
+const defaultMingwTarget = "x86_64-w64-mingw32"
+
+// isMingw returns true if the toolchain options ask for MinGW, either explicitly or through the target triple.
+func isMingw(toolchain ToolchainOptions) bool {
+	return toolchain.Toolset == "mingw" || strings.Contains(toolchain.Target, "-mingw")
+}
+
+func getMingwCompiler(toolchain ToolchainOptions) (Compiler, error) {
+	target := toolchain.Target
+
+	// MinGW is always selected explicitly, so the CC and CXX environment variables (which are usually meant for the
+	// host) are not used here
+	var cc []string
+	if _, err := exec.LookPath(target + "-gcc"); err == nil {
+		cc = []string{target + "-gcc"}
+	} else if _, err := exec.LookPath("gcc"); err == nil && runtime.GOOS == "windows" {
+		// MSYS2 and similar distributions of MinGW don't prefix their commands with the target
+		cc = []string{"gcc"}
+	} else {
+		return nil, fmt.Errorf("couldn't find %s-gcc in the PATH", target)
+	}
+
+	// We need the C++ compiler to link
+	cxx := cxxCommand(cc)
+
+	info, err := detectCompiler(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	ar := findMingwTool(target, "ar")
+	targetArgs := gccTargetArgs(info.family, target, toolchain.Sysroot)
+	ret := mingwCompiler{
+		gccCompiler: gccCompiler{
+			cc:         cc,
+			cxx:        cxx,
+			caps:       newCompilerCapabilities(cc, cxx, info, targetArgs),
+			ar:         ar,
+			ltoAr:      ltoArchiver(info.family, cc, ar),
+			targetArgs: targetArgs,
+		},
+		target:  target,
+		version: info.version,
+		windres: findMingwTool(target, "windres"),
+	}
+	return ret, nil
+}
+
+// findMingwTool returns the command of a binutils tool for the target, like "ar" or "windres".
+func findMingwTool(target, name string) string {
+	if _, err := exec.LookPath(target + "-" + name); err == nil {
+		return target + "-" + name
+	}
+	return name
+}
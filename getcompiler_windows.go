@@ -5,6 +5,7 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os/exec"
 	"path/filepath"
@@ -18,7 +19,14 @@ type vswhereOutput struct {
 	InstallPath string `json:"installationPath"`
 }
 
-func getCompiler() (Compiler, error) {
+func getCompiler(toolchain ToolchainOptions) (Compiler, error) {
+	if toolchain.Toolset != "" && toolchain.Toolset != "msvc" {
+		return nil, fmt.Errorf("toolset %s is not supported on Windows, only msvc and mingw are", toolchain.Toolset)
+	}
+	if toolchain.Target != "" || toolchain.Sysroot != "" {
+		return nil, errors.New("cross-compiling with a target or sysroot is not supported with msvc")
+	}
+
 	ret := windowsCompiler{}
 
 	vswherePath := "C:\\Program Files (x86)\\Microsoft Visual Studio\\Installer\\vswhere.exe"
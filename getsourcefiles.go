@@ -4,9 +4,17 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 )
 
-func getSourceFiles() ([]string, error) {
+// getSourceFiles finds all the C and C++ files to compile. If resources is true, Windows resource scripts are
+// included as well.
+func getSourceFiles(resources bool) ([]string, error) {
+	pattern := "\\.(cpp|c)$"
+	if resources {
+		pattern = "\\.(cpp|c|rc)$"
+	}
+
 	ret := make([]string, 0)
 	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -17,7 +25,7 @@ func getSourceFiles() ([]string, error) {
 			return nil
 		}
 
-		if ok, _ := regexp.Match("\\.(cpp|c)$", []byte(path)); !ok {
+		if ok, _ := regexp.Match(pattern, []byte(path)); !ok {
 			return nil
 		}
 
@@ -26,3 +34,21 @@ func getSourceFiles() ([]string, error) {
 	})
 	return ret, err
 }
+
+// sourceLanguages returns the languages of the given source files, either "c" or "c++".
+func sourceLanguages(files []string) []string {
+	ret := make([]string, 0)
+	for _, file := range files {
+		language := ""
+		switch filepath.Ext(file) {
+		case ".c":
+			language = "c"
+		case ".cpp":
+			language = "c++"
+		}
+		if language != "" && !slices.Contains(ret, language) {
+			ret = append(ret, language)
+		}
+	}
+	return ret
+}
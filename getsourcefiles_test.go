@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSourceLanguages(t *testing.T) {
+	tests := []struct {
+		files []string
+		want  []string
+	}{
+		{[]string{}, []string{}},
+		{[]string{"main.c", "util.c"}, []string{"c"}},
+		{[]string{"main.cpp"}, []string{"c++"}},
+		{[]string{"src/main.cpp", "src/lib.c", "src/more.cpp"}, []string{"c++", "c"}},
+		{[]string{"app.rc", "main.c"}, []string{"c"}},
+		{[]string{"app.rc"}, []string{}},
+	}
+
+	for _, test := range tests {
+		if got := sourceLanguages(test.files); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sourceLanguages(%q) = %q, want %q", test.files, got, test.want)
+		}
+	}
+}
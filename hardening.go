@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codecat/go-libs/log"
+)
+
+// hardeningCheck is a property of a hardened binary that "qb check-hardening" verifies. Optional properties depend
+// on the system or on the code of the program, and are reported without failing the check.
+type hardeningCheck struct {
+	name     string
+	optional bool
+	check    func(f *elf.File) (bool, string)
+}
+
+var hardeningChecks = []hardeningCheck{
+	{"PIE", false, checkPIE},
+	{"RELRO", false, checkRELRO},
+	{"stack protector", true, checkStackProtector},
+	{"fortify source", true, checkFortifySource},
+	{"non-executable stack", false, checkNXStack},
+	{"CET", true, checkCET},
+}
+
+func commandCheckHardening(args []string) int {
+	if !noArguments("check-hardening", args) {
+		return 1
+	}
+
+	contexts, _ := loadProject()
+
+	problems := 0
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, ctx := range contexts {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		outPath := ctx.Compiler.OutputFile(filepath.Join(ctx.OutPath, ctx.Name), ctx.Type)
+		fmt.Fprintf(w, "%s%s\n", ctx.logPrefix(), outPath)
+
+		if ctx.Type == LinkLib {
+			problems++
+			fmt.Fprintf(w, "  static libraries can't be checked, as they're not linked yet\n")
+			continue
+		}
+
+		f, err := elf.Open(outPath)
+		if err != nil {
+			problems++
+			if errors.Is(err, os.ErrNotExist) {
+				fmt.Fprintf(w, "  not found, build the project first\n")
+			} else {
+				fmt.Fprintf(w, "  not an ELF binary: %s\n", err.Error())
+			}
+			continue
+		}
+
+		for _, check := range hardeningChecks {
+			ok, detail := check.check(f)
+			status := "ok"
+			if !ok && check.optional {
+				status = "missing"
+			} else if !ok {
+				problems++
+				status = "FAILED"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", check.name, status, detail)
+		}
+		f.Close()
+	}
+	w.Flush()
+
+	if problems > 0 {
+		log.Fatal("😢 Found %d problem(s)! (build with --harden)", problems)
+		return 1
+	}
+	log.Info("👏 The binary is hardened")
+	return 0
+}
+
+// checkPIE checks whether an executable is position independent, so that it's loaded at a random address. Shared
+// libraries always are.
+func checkPIE(f *elf.File) (bool, string) {
+	if f.Type != elf.ET_DYN {
+		return false, "not position independent"
+	}
+	if flags, ok := dynamicValue(f, elf.DT_FLAGS_1); ok && flags&uint64(elf.DF_1_PIE) != 0 {
+		return true, "position independent executable"
+	}
+	return true, "position independent"
+}
+
+// checkRELRO checks whether relocations are made read-only after they're resolved at startup, which protects the
+// global offset table from being overwritten. Only resolving all symbols at startup makes this full RELRO.
+func checkRELRO(f *elf.File) (bool, string) {
+	if !hasProgram(f, elf.PT_GNU_RELRO) {
+		return false, "no RELRO"
+	}
+
+	_, bindNow := dynamicValue(f, elf.DT_BIND_NOW)
+	if flags, ok := dynamicValue(f, elf.DT_FLAGS); ok && flags&uint64(elf.DF_BIND_NOW) != 0 {
+		bindNow = true
+	}
+	if flags, ok := dynamicValue(f, elf.DT_FLAGS_1); ok && flags&uint64(elf.DF_1_NOW) != 0 {
+		bindNow = true
+	}
+	if !bindNow {
+		return false, "partial RELRO"
+	}
+	return true, "full RELRO"
+}
+
+// checkStackProtector checks whether the binary calls the stack protector's failure handler. Functions without any
+// buffers on the stack don't get a canary, so this is optional, as tiny programs might not need one at all.
+func checkStackProtector(f *elf.File) (bool, string) {
+	if hasSymbol(f, func(name string) bool { return name == "__stack_chk_fail" }) {
+		return true, "uses __stack_chk_fail"
+	}
+	return false, "no stack canaries found, which is fine if no function has buffers on the stack"
+}
+
+// checkFortifySource checks whether the binary calls any of the checked versions of C library functions, like
+// __printf_chk. This is optional, as binaries might not call any of the functions that can be checked.
+func checkFortifySource(f *elf.File) (bool, string) {
+	fortified := make(map[string]bool)
+	hasSymbol(f, func(name string) bool {
+		if strings.HasPrefix(name, "__") && strings.HasSuffix(name, "_chk") && name != "__stack_chk_fail" {
+			fortified[name] = true
+		}
+		return false
+	})
+	if len(fortified) == 0 {
+		return false, "no fortified functions found, which is fine if none of the functions that can be checked are called"
+	}
+	return true, fmt.Sprintf("%d fortified function(s)", len(fortified))
+}
+
+// checkNXStack checks whether the stack is not executable.
+func checkNXStack(f *elf.File) (bool, string) {
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_GNU_STACK {
+			if prog.Flags&elf.PF_X != 0 {
+				return false, "executable stack"
+			}
+			return true, "non-executable stack"
+		}
+	}
+	return false, "no stack segment, so the stack may be executable"
+}
+
+// checkCET checks whether the binary is marked as compatible with Intel CET indirect branch tracking and shadow
+// stacks. This only applies to x86 binaries. The linker only marks the binary if every object is compatible.
+func checkCET(f *elf.File) (bool, string) {
+	if f.Machine != elf.EM_X86_64 && f.Machine != elf.EM_386 {
+		return true, "not applicable to " + strings.TrimPrefix(f.Machine.String(), "EM_")
+	}
+
+	var features uint32
+	if section := f.Section(".note.gnu.property"); section != nil {
+		if data, err := section.Data(); err == nil {
+			features = x86Features(data, f.Class, f.ByteOrder)
+		}
+	}
+
+	const ibt, shstk = 1, 2
+	switch {
+	case features&ibt != 0 && features&shstk != 0:
+		return true, "IBT and SHSTK"
+	case features&ibt != 0:
+		return false, "IBT only"
+	case features&shstk != 0:
+		return false, "SHSTK only"
+	}
+	return false, "not marked as CET compatible, which requires the C runtime to be built with CET as well"
+}
+
+// x86Features returns the x86 feature bits of a GNU property note section, which contain the CET properties.
+func x86Features(data []byte, class elf.Class, order binary.ByteOrder) uint32 {
+	const noteTypeProperty = 5
+	const propertyX86Feature1And = 0xc0000002
+
+	// Notes and properties are aligned to 8 bytes in 64-bit binaries, and to 4 bytes otherwise
+	align := 4
+	if class == elf.ELFCLASS64 {
+		align = 8
+	}
+	pad := func(n int) int {
+		return (n + align - 1) &^ (align - 1)
+	}
+
+	var features uint32
+	for len(data) >= 12 {
+		nameSize := int(order.Uint32(data[0:]))
+		descSize := int(order.Uint32(data[4:]))
+		noteType := order.Uint32(data[8:])
+		descOffset := pad(12 + nameSize)
+		if descOffset+descSize > len(data) {
+			break
+		}
+		name := data[12 : 12+nameSize]
+		desc := data[descOffset : descOffset+descSize]
+		data = data[min(len(data), pad(descOffset+descSize)):]
+
+		if noteType != noteTypeProperty || !bytes.Equal(name, []byte("GNU\x00")) {
+			continue
+		}
+		for len(desc) >= 8 {
+			propertyType := order.Uint32(desc[0:])
+			propertySize := int(order.Uint32(desc[4:]))
+			if 8+propertySize > len(desc) {
+				break
+			}
+			if propertyType == propertyX86Feature1And && propertySize >= 4 {
+				features |= order.Uint32(desc[8:])
+			}
+			desc = desc[min(len(desc), pad(8+propertySize)):]
+		}
+	}
+	return features
+}
+
+// dynamicValue returns the value of a tag in the dynamic section, and whether the tag exists.
+func dynamicValue(f *elf.File, tag elf.DynTag) (uint64, bool) {
+	values, err := f.DynValue(tag)
+	if err != nil || len(values) == 0 {
+		return 0, false
+	}
+	return values[0], true
+}
+
+// hasProgram returns true if the binary has a segment of the given type.
+func hasProgram(f *elf.File, progType elf.ProgType) bool {
+	for _, prog := range f.Progs {
+		if prog.Type == progType {
+			return true
+		}
+	}
+	return false
+}
+
+// hasSymbol returns true if any of the dynamic or static symbols of the binary match. Versioned names like
+// "__printf_chk@GLIBC_2.3.4" are matched without their version.
+func hasSymbol(f *elf.File, match func(name string) bool) bool {
+	dynamic, _ := f.DynamicSymbols()
+	static, _ := f.Symbols()
+	for _, symbols := range [][]elf.Symbol{dynamic, static} {
+		for _, symbol := range symbols {
+			name, _, _ := strings.Cut(symbol.Name, "@")
+			if match(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
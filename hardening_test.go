@@ -0,0 +1,77 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+func TestX86Features(t *testing.T) {
+	tests := []struct {
+		name  string
+		class elf.Class
+		note  string
+		want  uint32
+	}{
+		{
+			// gcc -fcf-protection=full -c on x86_64
+			name:  "64-bit IBT and SHSTK",
+			class: elf.ELFCLASS64,
+			note:  "040000001000000005000000474e5500020000c0040000000300000000000000",
+			want:  3,
+		},
+		{
+			// gcc -fcf-protection=branch -c on x86_64
+			name:  "64-bit IBT only",
+			class: elf.ELFCLASS64,
+			note:  "040000001000000005000000474e5500020000c0040000000100000000000000",
+			want:  1,
+		},
+		{
+			// gcc -m32 -fcf-protection=full -c
+			name:  "32-bit IBT and SHSTK",
+			class: elf.ELFCLASS32,
+			note:  "040000000c00000005000000474e5500020000c00400000003000000",
+			want:  3,
+		},
+		{
+			// An x86 ISA needed property comes before the feature property
+			name:  "64-bit with other properties",
+			class: elf.ELFCLASS64,
+			note:  "040000002000000005000000474e5500028000c0040000000100000000000000020000c0040000000200000000000000",
+			want:  2,
+		},
+		{
+			// A note that is not a GNU property note comes first
+			name:  "64-bit after another note",
+			class: elf.ELFCLASS64,
+			note:  "040000000400000001000000474e55000000000000000000" + "040000001000000005000000474e5500020000c0040000000300000000000000",
+			want:  3,
+		},
+		{
+			name:  "empty",
+			class: elf.ELFCLASS64,
+			note:  "",
+			want:  0,
+		},
+		{
+			name:  "truncated",
+			class: elf.ELFCLASS64,
+			note:  "040000001000000005000000474e5500020000c004000000",
+			want:  0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := hex.DecodeString(test.note)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := x86Features(data, test.class, binary.LittleEndian); got != test.want {
+				t.Errorf("x86Features() = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/codecat/go-libs/log"
+	"github.com/mattn/go-shellwords"
+)
+
+// loadContext loads the basic project settings of a configuration into the context.
+func loadContext(ctx *Context, config *Configuration) {
+	ctx.ConfigurationName = config.Name
+
+	// Find the name of the project
+	ctx.Name = config.GetString("name")
+	if ctx.Name == "" {
+		// If there's no name set, use the name of the current directory
+		currentDir, _ := filepath.Abs(".")
+		ctx.Name = filepath.Base(currentDir)
+	}
+
+	// Get the output path, which is a sub-directory for named configurations
+	ctx.OutPath = config.GetString("out")
+	if config.Name != "" {
+		ctx.OutPath = filepath.Join(ctx.OutPath, config.Name)
+	}
+
+	// Get the link type
+	linkType := config.GetString("type")
+	switch linkType {
+	case "exe":
+		ctx.Type = LinkExe
+	case "dll":
+		ctx.Type = LinkDll
+	case "lib":
+		ctx.Type = LinkLib
+	default:
+		configIssue("Unrecognized link type %s%s", linkType, didYouMean(linkType, optionValues["type"]))
+		ctx.Type = LinkExe
+	}
+}
+
+// loadCompilerOptions loads the compiler options of a configuration into the context.
+func loadCompilerOptions(ctx *Context, config *Configuration, conan Conanfile) {
+	// Load any compiler options
+	ctx.CompilerOptions.Static = config.GetBool("static")
+	ctx.CompilerOptions.Debug = config.GetBool("debug")
+	ctx.CompilerOptions.SplitDWARF = config.GetBool("split-dwarf")
+	ctx.CompilerOptions.CompressDebug = config.GetBool("compress-debug")
+	ctx.CompilerOptions.Verbose = config.GetBool("verbose")
+	ctx.CompilerOptions.Strict = config.GetBool("strict")
+	ctx.CompilerOptions.Harden = config.GetBool("harden")
+
+	// Load the exceptions method
+	exceptionsType := config.GetString("exceptions")
+	switch exceptionsType {
+	case "", "std", "standard":
+		ctx.CompilerOptions.Exceptions = ExceptionsStandard
+	case "all":
+		ctx.CompilerOptions.Exceptions = ExceptionsAll
+	case "min", "minimal":
+		ctx.CompilerOptions.Exceptions = ExceptionsMinimal
+	default:
+		configIssue("Unrecognized exceptions type %s%s", exceptionsType, didYouMean(exceptionsType, optionValues["exceptions"]))
+	}
+
+	// Load where the debug information goes
+	debugInfo := config.GetString("debuginfo")
+	switch debugInfo {
+	case "", "embedded":
+		ctx.CompilerOptions.DebugInfo = DebugInfoEmbedded
+	case "split":
+		ctx.CompilerOptions.DebugInfo = DebugInfoSplit
+	case "none":
+		ctx.CompilerOptions.DebugInfo = DebugInfoNone
+	default:
+		configIssue("Unrecognized debug information type %s%s", debugInfo, didYouMean(debugInfo, optionValues["debuginfo"]))
+	}
+
+	// Load optimization options
+	optimizeType := config.GetString("optimize")
+	switch optimizeType {
+	case "", "default":
+		ctx.CompilerOptions.Optimization = OptimizeDefault
+	case "none":
+		ctx.CompilerOptions.Optimization = OptimizeNone
+	case "size":
+		ctx.CompilerOptions.Optimization = OptimizeSize
+	case "speed":
+		ctx.CompilerOptions.Optimization = OptimizeSpeed
+	default:
+		configIssue("Unrecognized optimization type %s%s", optimizeType, didYouMean(optimizeType, optionValues["optimize"]))
+	}
+
+	// If we're on default optimization, optimize for speed if we're not a debug build
+	if ctx.CompilerOptions.Optimization == OptimizeDefault && !ctx.CompilerOptions.Debug {
+		ctx.CompilerOptions.Optimization = OptimizeSpeed
+	}
+
+	// Load C++ compiler standard
+	cppStandard := config.GetString("cppstd")
+	switch cppStandard {
+	case "", "latest":
+		ctx.CompilerOptions.CPPStandard = CPPStandardLatest
+	case "26":
+		ctx.CompilerOptions.CPPStandard = CPPStandard26
+	case "23":
+		ctx.CompilerOptions.CPPStandard = CPPStandard23
+	case "20":
+		ctx.CompilerOptions.CPPStandard = CPPStandard20
+	case "17":
+		ctx.CompilerOptions.CPPStandard = CPPStandard17
+	case "14":
+		ctx.CompilerOptions.CPPStandard = CPPStandard14
+	default:
+		configIssue("Unrecognized C++ compiler standard %s%s", cppStandard, didYouMean(cppStandard, optionValues["cppstd"]))
+	}
+
+	// Load C compiler standard
+	cStandard := config.GetString("cstd")
+	switch cStandard {
+	case "", "latest":
+		ctx.CompilerOptions.CStandard = CStandardLatest
+	case "23":
+		ctx.CompilerOptions.CStandard = CStandard23
+	case "17":
+		ctx.CompilerOptions.CStandard = CStandard17
+	case "11":
+		ctx.CompilerOptions.CStandard = CStandard11
+	default:
+		configIssue("Unrecognized C compiler standard %s%s", cStandard, didYouMean(cStandard, optionValues["cstd"]))
+	}
+
+	// Load the C++ standard library
+	stdLib := config.GetString("stdlib")
+	switch stdLib {
+	case "", "default":
+		ctx.CompilerOptions.StdLib = StdLibDefault
+	case "libc++":
+		ctx.CompilerOptions.StdLib = StdLibLibCPP
+	case "libstdc++":
+		ctx.CompilerOptions.StdLib = StdLibLibStdCPP
+	default:
+		configIssue("Unrecognized C++ standard library %s%s", stdLib, didYouMean(stdLib, optionValues["stdlib"]))
+	}
+
+	// Load the linker
+	linker := config.GetString("linker")
+	switch linker {
+	case "", "default":
+		ctx.CompilerOptions.Linker = LinkerDefault
+	case "lld":
+		ctx.CompilerOptions.Linker = LinkerLLD
+	case "mold":
+		ctx.CompilerOptions.Linker = LinkerMold
+	case "gold":
+		ctx.CompilerOptions.Linker = LinkerGold
+	case "bfd":
+		ctx.CompilerOptions.Linker = LinkerBFD
+	default:
+		configIssue("Unrecognized linker %s%s", linker, didYouMean(linker, optionValues["linker"]))
+	}
+
+	// Load link-time optimization mode
+	lto := config.GetString("lto")
+	switch lto {
+	case "", "off":
+		ctx.CompilerOptions.LTO = LTOOff
+	case "thin":
+		ctx.CompilerOptions.LTO = LTOThin
+	case "full":
+		ctx.CompilerOptions.LTO = LTOFull
+	default:
+		configIssue("Unrecognized link-time optimization mode %s%s", lto, didYouMean(lto, optionValues["lto"]))
+	}
+
+	// Load the sanitizers, in a fixed order so that the same flags are passed however they're given
+	sanitizers := config.GetStringSlice("sanitize")
+	for _, sanitizer := range sanitizers {
+		if !slices.Contains(optionValues["sanitize"], sanitizer) {
+			configIssue("Unrecognized sanitizer %s%s", sanitizer, didYouMean(sanitizer, optionValues["sanitize"]))
+		}
+	}
+	for _, sanitizer := range optionValues["sanitize"] {
+		if slices.Contains(sanitizers, sanitizer) {
+			ctx.CompilerOptions.Sanitize = append(ctx.CompilerOptions.Sanitize, sanitizer)
+		}
+	}
+
+	// Continue profile-guided optimization where "qb pgo" left off
+	loadPGOState(ctx)
+
+	// Load the header to precompile
+	ctx.CompilerOptions.PCH = config.GetString("pch")
+	if ctx.CompilerOptions.PCH != "" && !fileExists(ctx.CompilerOptions.PCH) {
+		configIssue("Precompiled header %s doesn't exist", ctx.CompilerOptions.PCH)
+		ctx.CompilerOptions.PCH = ""
+	}
+
+	// Load the languages to precompile the header for, in a fixed order like the sanitizers
+	pchLanguages := config.GetStringSlice("pch-languages")
+	for _, language := range pchLanguages {
+		if !slices.Contains(optionValues["pch-languages"], language) {
+			configIssue("Unrecognized precompiled header language %s%s", language, didYouMean(language, optionValues["pch-languages"]))
+		}
+	}
+	for _, language := range optionValues["pch-languages"] {
+		if slices.Contains(pchLanguages, language) {
+			ctx.CompilerOptions.PCHLanguages = append(ctx.CompilerOptions.PCHLanguages, language)
+		}
+	}
+
+	// Add custom include directories
+	ctx.trackSettingOrigins(config, "include", func() {
+		includes := config.GetStringSlice("include")
+		for _, include := range includes {
+			fi, err := os.Stat(include)
+			if err != nil {
+				log.Warn("Unable to include directory %s: %s", include, err.Error())
+				continue
+			}
+
+			if !fi.IsDir() {
+				log.Warn("Include path is not a directory: %s", include)
+				continue
+			}
+
+			ctx.CompilerOptions.IncludeDirectories = append(ctx.CompilerOptions.IncludeDirectories, include)
+		}
+	})
+
+	// Add preprocessor definitions
+	ctx.trackSettingOrigins(config, "define", func() {
+		defines := config.GetStringSlice("define")
+		ctx.CompilerOptions.Defines = append(ctx.CompilerOptions.Defines, defines...)
+	})
+
+	// Add library directories and libraries to link with
+	ctx.trackSettingOrigins(config, "linkdir", func() {
+		linkdirs := config.GetStringSlice("linkdir")
+		ctx.CompilerOptions.LinkDirectories = append(ctx.CompilerOptions.LinkDirectories, linkdirs...)
+	})
+
+	for _, link := range config.GetStringSlice("link") {
+		ctx.trackOrigins(func() string {
+			ctx.CompilerOptions.LinkLibraries = append(ctx.CompilerOptions.LinkLibraries, link)
+			return config.Origin("link", link)
+		})
+	}
+
+	// Add additional compiler and linker flags
+	addSettingFlags(ctx, config, "cflags", &ctx.CompilerOptions.CompilerFlagsCXX)
+	addSettingFlags(ctx, config, "cxxflags", &ctx.CompilerOptions.CompilerFlagsCPP)
+	addSettingFlags(ctx, config, "ldflags", &ctx.CompilerOptions.LinkerFlags)
+
+	// Find packages
+	packages := config.GetStringSlice("pkg")
+	for _, pkg := range packages {
+		ctx.trackOrigins(func() string {
+			pkgInfo := addPackage(ctx.CompilerOptions, pkg)
+			if pkgInfo == nil {
+				log.Warn("Unable to find package %s!", pkg)
+				return ""
+			}
+			return fmt.Sprintf("package %s (%s)", pkg, pkgInfo.Source)
+		})
+	}
+
+	// To support Conan: use the dependencies from conanbuildinfo.txt
+	if conan != nil {
+		ctx.trackOrigins(func() string {
+			addConanPackages(ctx, conan)
+			return "conanbuildinfo.txt"
+		})
+	}
+
+	// Add the conventional compiler and linker flags from the environment
+	envFlags := []struct {
+		name string
+		dest *[]string
+	}{
+		{"CPPFLAGS", &ctx.CompilerOptions.CompilerFlagsCXX},
+		{"CFLAGS", &ctx.CompilerOptions.CompilerFlagsC},
+		{"CXXFLAGS", &ctx.CompilerOptions.CompilerFlagsCPP},
+		{"LDFLAGS", &ctx.CompilerOptions.LinkerFlags},
+	}
+	for _, env := range envFlags {
+		ctx.trackOrigins(func() string {
+			flags, err := shellwords.Parse(os.Getenv(env.name))
+			if err != nil {
+				log.Warn("Unable to parse %s: %s", env.name, err.Error())
+				return ""
+			}
+			*env.dest = append(*env.dest, flags...)
+			return "environment variable " + env.name
+		})
+	}
+}
+
+// addSettingFlags splits the values of a setting into shell words and appends them to the given flags.
+func addSettingFlags(ctx *Context, config *Configuration, key string, flags *[]string) {
+	for _, value := range config.GetStringSlice(key) {
+		ctx.trackOrigins(func() string {
+			words, err := shellwords.Parse(value)
+			if err != nil {
+				configIssue("Unable to parse %s \"%s\": %s", key, value, err.Error())
+				return ""
+			}
+			*flags = append(*flags, words...)
+			return config.Origin(key, value)
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLoadCompilerOptionsFlags(t *testing.T) {
+	type flags struct {
+		Defines, CompilerFlagsCXX, CompilerFlagsC, CompilerFlagsCPP, LinkerFlags []string
+	}
+
+	tests := []struct {
+		name   string
+		config string
+		env    map[string]string
+		args   []string
+		want   flags
+	}{
+		{
+			name: "CPPFLAGS is for C and C++ files",
+			env:  map[string]string{"CPPFLAGS": "-DA -DB"},
+			want: flags{CompilerFlagsCXX: []string{"-DA", "-DB"}},
+		},
+		{
+			name: "CFLAGS is for C files",
+			env:  map[string]string{"CFLAGS": "-std=gnu99"},
+			want: flags{CompilerFlagsC: []string{"-std=gnu99"}},
+		},
+		{
+			name: "CXXFLAGS is for C++ files",
+			env:  map[string]string{"CXXFLAGS": "-fno-rtti"},
+			want: flags{CompilerFlagsCPP: []string{"-fno-rtti"}},
+		},
+		{
+			name: "LDFLAGS is not split on commas",
+			env:  map[string]string{"LDFLAGS": "-Wl,-rpath,/opt/lib -s"},
+			want: flags{LinkerFlags: []string{"-Wl,-rpath,/opt/lib", "-s"}},
+		},
+		{
+			name: "QB_ variables are the same as the options",
+			env:  map[string]string{"QB_CFLAGS": "-O1 -g", "QB_CXXFLAGS": "-fno-exceptions", "QB_LDFLAGS": "-Wl,--as-needed"},
+			want: flags{
+				CompilerFlagsCXX: []string{"-O1", "-g"},
+				CompilerFlagsCPP: []string{"-fno-exceptions"},
+				LinkerFlags:      []string{"-Wl,--as-needed"},
+			},
+		},
+		{
+			name: "options are split into shell words",
+			args: []string{"--cflags", "-march=native -fno-plt", "--cflags", "-DNAME='a b'", "--ldflags=-Wl,-z,now"},
+			want: flags{
+				CompilerFlagsCXX: []string{"-march=native", "-fno-plt", "-DNAME=a b"},
+				LinkerFlags:      []string{"-Wl,-z,now"},
+			},
+		},
+		{
+			name:   "configuration file entries are split into shell words",
+			config: "cflags = [\"-Wall -Wextra\"]\ncxxflags = [\"-fno-rtti\"]\n",
+			want: flags{
+				CompilerFlagsCXX: []string{"-Wall", "-Wextra"},
+				CompilerFlagsCPP: []string{"-fno-rtti"},
+			},
+		},
+		{
+			name: "options come before the environment variables",
+			env:  map[string]string{"CPPFLAGS": "-O2"},
+			args: []string{"--cflags", "-O1"},
+			want: flags{CompilerFlagsCXX: []string{"-O1", "-O2"}},
+		},
+		{
+			name: "other lists are split on commas",
+			env:  map[string]string{"QB_DEFINE": "A,B"},
+			want: flags{Defines: []string{"A", "B"}},
+		},
+		{
+			name: "other list options are split on commas",
+			args: []string{"--define", "A,B", "--define", "C"},
+			want: flags{Defines: []string{"A", "B", "C"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, name := range []string{"QB_PROFILE", "QB_DEFINE", "QB_CFLAGS", "QB_CXXFLAGS", "QB_LDFLAGS", "CPPFLAGS", "CFLAGS", "CXXFLAGS", "LDFLAGS"} {
+				t.Setenv(name, test.env[name])
+			}
+			loadTestProject(t, test.config, test.args...)
+
+			ctx := NewContext(nil)
+			loadCompilerOptions(ctx, &Configuration{}, nil)
+
+			options := ctx.CompilerOptions
+			got := flags{options.Defines, options.CompilerFlagsCXX, options.CompilerFlagsC, options.CompilerFlagsCPP, options.LinkerFlags}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
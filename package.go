@@ -1,7 +1,9 @@
 package main
 
 import (
+	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
 	"strings"
 
@@ -12,6 +14,9 @@ import (
 // Package contains basic information about a library.
 type Package struct {
 	Name string
+
+	// Source describes where the package was found.
+	Source string
 }
 
 func addPackage(options *CompilerOptions, name string) *Package {
@@ -19,8 +24,6 @@ func addPackage(options *CompilerOptions, name string) *Package {
 		return ret
 	}
 
-	//TODO: Implement global packages
-
 	if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
 		if ret := addPackagePkgconfig(options, name); ret != nil {
 			return ret
@@ -34,6 +37,8 @@ func addPackage(options *CompilerOptions, name string) *Package {
 	return nil
 }
 
+// addPackageLocal finds a package in the configuration. This includes packages defined in the global configuration
+// files, as they are merged beneath the project configuration file.
 func addPackageLocal(options *CompilerOptions, name string) *Package {
 	packageInfo := viper.GetStringMap("package." + name)
 	if len(packageInfo) == 0 {
@@ -43,20 +48,103 @@ func addPackageLocal(options *CompilerOptions, name string) *Package {
 	return configurePackageFromConfig(options, packageInfo, name)
 }
 
+// pkgconfigResult contains the parsed output of pkg-config for a single package.
+type pkgconfigResult struct {
+	cflags []string
+	libs   []string
+}
+
+// pkgconfigCache remembers pkg-config lookups, so that they only have to be done once when building multiple
+// configurations. A nil entry means the package could not be found.
+var pkgconfigCache = make(map[string]*pkgconfigResult)
+
 func addPackagePkgconfig(options *CompilerOptions, name string) *Package {
+	res, ok := pkgconfigCache[name]
+	if !ok {
+		res = queryPkgconfig(name)
+		pkgconfigCache[name] = res
+	}
+	if res == nil {
+		return nil
+	}
+
+	options.CompilerFlagsCXX = append(options.CompilerFlagsCXX, res.cflags...)
+	options.LinkerFlags = append(options.LinkerFlags, res.libs...)
+
+	return &Package{
+		Name:   name,
+		Source: "pkg-config",
+	}
+}
+
+// pkgconfigCommand creates a pkg-config command that looks up packages for the target of the toolchain. When
+// cross-compiling, a "<triple>-pkg-config" wrapper is used if there is one. Otherwise, the search path of pkg-config
+// is pointed at the libraries of the target, unless PKG_CONFIG_LIBDIR is already set.
+func pkgconfigCommand(args ...string) *exec.Cmd {
+	target := toolchain.Target
+	sysroot := toolchain.Sysroot
+
+	if target != "" {
+		if _, err := exec.LookPath(target + "-pkg-config"); err == nil {
+			cmd := exec.Command(target+"-pkg-config", args...)
+			if sysroot != "" {
+				cmd.Env = append(os.Environ(), "PKG_CONFIG_SYSROOT_DIR="+sysroot)
+			}
+			return cmd
+		}
+	}
+
+	cmd := exec.Command("pkg-config", args...)
+	if target == "" && sysroot == "" {
+		return cmd
+	}
+
+	cmd.Env = os.Environ()
+	if sysroot != "" {
+		cmd.Env = append(cmd.Env, "PKG_CONFIG_SYSROOT_DIR="+sysroot)
+	}
+	if os.Getenv("PKG_CONFIG_LIBDIR") == "" {
+		dirs := pkgconfigLibDirs(target, sysroot)
+		cmd.Env = append(cmd.Env, "PKG_CONFIG_LIBDIR="+strings.Join(dirs, string(os.PathListSeparator)))
+	}
+	return cmd
+}
+
+// pkgconfigLibDirs returns the directories where pkg-config should look for the packages of the target. Without a
+// sysroot, the libraries of the target are installed in the root of the host, either multiarch or in /usr/<triple>.
+func pkgconfigLibDirs(target, sysroot string) []string {
+	root := sysroot
+	if root == "" {
+		root = "/"
+	}
+
+	dirs := make([]string, 0)
+	if target != "" {
+		dirs = append(dirs, filepath.Join(root, "usr", "lib", target, "pkgconfig"))
+	}
+	if sysroot != "" {
+		dirs = append(dirs, filepath.Join(sysroot, "usr", "lib", "pkgconfig"))
+	} else {
+		dirs = append(dirs, filepath.Join(root, "usr", target, "lib", "pkgconfig"))
+	}
+	return append(dirs, filepath.Join(root, "usr", "share", "pkgconfig"))
+}
+
+func queryPkgconfig(name string) *pkgconfigResult {
+	cmdCflags := pkgconfigCommand(name, "--cflags")
+
 	// pkg-config must be installed for this to work
-	_, err := exec.LookPath("pkg-config")
+	_, err := exec.LookPath(cmdCflags.Path)
 	if err != nil {
 		return nil
 	}
 
-	cmdCflags := exec.Command("pkg-config", name, "--cflags")
 	outputCflags, err := cmdCflags.CombinedOutput()
 	if err != nil {
 		return nil
 	}
 
-	cmdLibs := exec.Command("pkg-config", name, "--libs")
+	cmdLibs := pkgconfigCommand(name, "--libs")
 	outputLibs, err := cmdLibs.CombinedOutput()
 	if err != nil {
 		return nil
@@ -65,11 +153,9 @@ func addPackagePkgconfig(options *CompilerOptions, name string) *Package {
 	parseCflags, _ := shellwords.Parse(strings.Trim(string(outputCflags), "\r\n"))
 	parseLibs, _ := shellwords.Parse(strings.Trim(string(outputLibs), "\r\n"))
 
-	options.CompilerFlagsCXX = append(options.CompilerFlagsCXX, parseCflags...)
-	options.LinkerFlags = append(options.LinkerFlags, parseLibs...)
-
-	return &Package{
-		Name: name,
+	return &pkgconfigResult{
+		cflags: parseCflags,
+		libs:   parseLibs,
 	}
 }
 
@@ -81,17 +167,32 @@ func configurePackageFromConfig(options *CompilerOptions, pkg map[string]interfa
 	maybeUnpack(&options.CompilerFlagsCXX, pkg["cflags"])
 	maybeUnpack(&options.LinkerFlags, pkg["lflags"])
 
+	// The package's settings could come from multiple configuration files, but we report the first one we find
+	source := "configuration"
+	for _, key := range packageSettings {
+		if origin, ok := configOrigins["package."+name+"."+key]; ok {
+			source = origin
+			break
+		}
+	}
+
 	return &Package{
-		Name: name,
+		Name:   name,
+		Source: source,
 	}
 }
 
+// maybeUnpack appends the strings in src to dest. Values of the wrong type are skipped, as they have already been
+// reported when validating the configuration.
 func maybeUnpack(dest *[]string, src interface{}) {
-	if src == nil {
+	list, ok := src.([]interface{})
+	if !ok {
 		return
 	}
 
-	for _, val := range src.([]interface{}) {
-		(*dest) = append(*dest, val.(string))
+	for _, val := range list {
+		if str, ok := val.(string); ok {
+			(*dest) = append(*dest, str)
+		}
 	}
 }
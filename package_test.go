@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPkgconfigCommand(t *testing.T) {
+	tests := []struct {
+		target, sysroot string
+		libDirs         []string
+	}{
+		{"", "", nil},
+		{"", "/sysroot", []string{"/sysroot/usr/lib/pkgconfig", "/sysroot/usr/share/pkgconfig"}},
+		{"aarch64-linux-gnu", "", []string{
+			"/usr/lib/aarch64-linux-gnu/pkgconfig",
+			"/usr/aarch64-linux-gnu/lib/pkgconfig",
+			"/usr/share/pkgconfig",
+		}},
+		{"aarch64-linux-gnu", "/sysroot", []string{
+			"/sysroot/usr/lib/aarch64-linux-gnu/pkgconfig",
+			"/sysroot/usr/lib/pkgconfig",
+			"/sysroot/usr/share/pkgconfig",
+		}},
+	}
+
+	// There's no <triple>-pkg-config wrapper in an empty PATH
+	t.Setenv("PATH", t.TempDir())
+	t.Setenv("PKG_CONFIG_LIBDIR", "")
+	t.Setenv("PKG_CONFIG_SYSROOT_DIR", "")
+
+	oldToolchain := toolchain
+	t.Cleanup(func() {
+		toolchain = oldToolchain
+	})
+
+	for _, test := range tests {
+		toolchain = ToolchainOptions{Target: test.target, Sysroot: test.sysroot}
+		cmd := pkgconfigCommand("zlib", "--libs")
+
+		for i, dir := range test.libDirs {
+			test.libDirs[i] = filepath.FromSlash(dir)
+		}
+		if got, want := envValue(cmd.Env, "PKG_CONFIG_LIBDIR"), strings.Join(test.libDirs, string(os.PathListSeparator)); got != want {
+			t.Errorf("PKG_CONFIG_LIBDIR for target %q and sysroot %q = %q, want %q", test.target, test.sysroot, got, want)
+		}
+		if got := envValue(cmd.Env, "PKG_CONFIG_SYSROOT_DIR"); got != test.sysroot {
+			t.Errorf("PKG_CONFIG_SYSROOT_DIR for target %q and sysroot %q = %q, want %q", test.target, test.sysroot, got, test.sysroot)
+		}
+	}
+}
+
+// envValue returns the value of a variable in an environment, which is the last one if it's set multiple times.
+func envValue(env []string, name string) string {
+	ret := ""
+	for _, entry := range env {
+		if value, ok := strings.CutPrefix(entry, name+"="); ok {
+			ret = value
+		}
+	}
+	return ret
+}
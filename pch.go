@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// resolvePCHLanguages decides which languages the header is precompiled for, once the languages of the source files
+// are known. Headers are often only valid in C++, so if no languages are given, it's only precompiled for C in
+// projects without any C++. Languages without any source files are left out.
+func resolvePCHLanguages(options *CompilerOptions) {
+	if options.PCH == "" {
+		options.PCHLanguages = nil
+		return
+	}
+
+	languages := options.PCHLanguages
+	if len(languages) == 0 {
+		languages = []string{"c"}
+		if slices.Contains(options.Languages, "c++") {
+			languages = []string{"c++"}
+		}
+	}
+
+	options.PCHLanguages = make([]string, 0, len(languages))
+	for _, language := range languages {
+		if slices.Contains(options.Languages, language) {
+			options.PCHLanguages = append(options.PCHLanguages, language)
+		}
+	}
+}
+
+// pchLanguagesReport returns the languages of the precompiled header as a single value for "qb config".
+func pchLanguagesReport(options *CompilerOptions) string {
+	if len(options.PCHLanguages) == 0 {
+		return "none"
+	}
+	return strings.Join(options.PCHLanguages, ",")
+}
+
+// pchLanguageDir returns the directory in the object directory in which the header is precompiled for a language.
+func pchLanguageDir(options *CompilerOptions, language string) string {
+	if language == "c++" {
+		return filepath.Join(options.PCHDir, "cpp")
+	}
+	return filepath.Join(options.PCHDir, "c")
+}
+
+// gccPCHOutput returns the path of the precompiled header for a language. gcc looks for a precompiled header next to
+// where it would find the header itself, so it gets the name of the header with ".gch" added.
+func gccPCHOutput(family, language string, options *CompilerOptions) string {
+	name := filepath.Base(options.PCH)
+	if family == "clang" {
+		return filepath.Join(pchLanguageDir(options, language), name+".pch")
+	}
+	return filepath.Join(pchLanguageDir(options, language), name+".gch")
+}
+
+// usesPCH returns true if source files of a language include the precompiled header.
+func usesPCH(language string, options *CompilerOptions) bool {
+	return options.PCHDir != "" && slices.Contains(options.PCHLanguages, language)
+}
+
+// gccPCHArgs returns the arguments that include the precompiled header in a source file of a language.
+func gccPCHArgs(family, language string, options *CompilerOptions) []string {
+	if !usesPCH(language, options) {
+		return nil
+	}
+	if family == "clang" {
+		return []string{"-include-pch", gccPCHOutput(family, language, options)}
+	}
+	return []string{"-include", filepath.Join(pchLanguageDir(options, language), filepath.Base(options.PCH)), "-Winvalid-pch"}
+}
+
+// writePCHSource writes a file into the directory of the precompiled header for a language that only includes the
+// header, and returns its path. Compiling this file instead of the header itself keeps compilers from warning about
+// "#pragma once" in the main file, and gives gcc a header to fall back to if it can't use the precompiled one.
+func writePCHSource(options *CompilerOptions, language, name string) (string, error) {
+	header, err := filepath.Abs(options.PCH)
+	if err != nil {
+		return "", err
+	}
+
+	dir := pchLanguageDir(options, language)
+	err = os.MkdirAll(dir, 0777)
+	if err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, name)
+	err = os.WriteFile(path, []byte(fmt.Sprintf("#include \"%s\"\n", filepath.ToSlash(header))), 0666)
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
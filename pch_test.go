@@ -0,0 +1,68 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolvePCHLanguages(t *testing.T) {
+	tests := []struct {
+		name      string
+		pch       string
+		languages []string
+		given     []string
+		want      []string
+	}{
+		{"no header", "", []string{"c", "c++"}, []string{"c"}, nil},
+		{"C++ by default", "pch.h", []string{"c", "c++"}, nil, []string{"c++"}},
+		{"C without C++", "pch.h", []string{"c"}, nil, []string{"c"}},
+		{"both languages", "pch.h", []string{"c", "c++"}, []string{"c", "c++"}, []string{"c", "c++"}},
+		{"only C in a mixed project", "pch.h", []string{"c", "c++"}, []string{"c"}, []string{"c"}},
+		{"languages without sources", "pch.h", []string{"c++"}, []string{"c", "c++"}, []string{"c++"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := &CompilerOptions{PCH: test.pch, Languages: test.languages, PCHLanguages: test.given}
+			resolvePCHLanguages(options)
+			if len(options.PCHLanguages) == 0 && len(test.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(options.PCHLanguages, test.want) {
+				t.Errorf("got %v, want %v", options.PCHLanguages, test.want)
+			}
+		})
+	}
+}
+
+func TestGccPCHArgs(t *testing.T) {
+	options := &CompilerOptions{
+		PCH:          filepath.Join("src", "pch.h"),
+		PCHLanguages: []string{"c++"},
+		PCHDir:       filepath.Join("obj", "pch"),
+	}
+
+	tests := []struct {
+		family   string
+		language string
+		want     []string
+	}{
+		{"gcc", "c++", []string{"-include", filepath.Join("obj", "pch", "cpp", "pch.h"), "-Winvalid-pch"}},
+		{"clang", "c++", []string{"-include-pch", filepath.Join("obj", "pch", "cpp", "pch.h.pch")}},
+		{"gcc", "c", nil},
+		{"clang", "c", nil},
+	}
+
+	for _, test := range tests {
+		if got := gccPCHArgs(test.family, test.language, options); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("gccPCHArgs(%s, %s) = %v, want %v", test.family, test.language, got, test.want)
+		}
+	}
+
+	// Nothing is included before the header has been precompiled
+	options.PCHDir = ""
+	if got := gccPCHArgs("gcc", "c++", options); got != nil {
+		t.Errorf("gccPCHArgs() without a precompiled header = %v, want nil", got)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/codecat/go-libs/log"
+)
+
+// pgoStatePath is the directory in which the profiles and the stage of profile-guided optimization are kept.
+var pgoStatePath = filepath.Join(".qb", "pgo")
+
+// loadPGOState sets the profile-guided optimization options of a configuration from the stage that "qb pgo" left
+// behind. Each configuration has its own profiles.
+func loadPGOState(ctx *Context) {
+	data, err := os.ReadFile(filepath.Join(pgoStatePath, "stage"))
+	if err != nil {
+		return
+	}
+
+	switch strings.TrimSpace(string(data)) {
+	case "generate":
+		ctx.CompilerOptions.PGO = PGOGenerate
+	case "use":
+		ctx.CompilerOptions.PGO = PGOUse
+	default:
+		configIssue("Unrecognized profile-guided optimization stage in %s", filepath.Join(pgoStatePath, "stage"))
+		return
+	}
+
+	if _, ok := ctx.Compiler.(PGOCompiler); !ok {
+		configIssue("The %s toolset doesn't support profile-guided optimization, so it's not used (run \"qb pgo off\" to stop using it)", ctx.Compiler.Toolset())
+		ctx.CompilerOptions.PGO = PGOOff
+		return
+	}
+
+	name := ctx.ConfigurationName
+	if name == "" {
+		name = "default"
+	}
+	ctx.CompilerOptions.ProfilePath, _ = filepath.Abs(filepath.Join(pgoStatePath, name))
+}
+
+// savePGOStage remembers the stage of profile-guided optimization for the next builds.
+func savePGOStage(stage PGOType) error {
+	err := os.MkdirAll(pgoStatePath, 0777)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(pgoStatePath, "stage"), []byte(stage.String()+"\n"), 0666)
+}
+
+// pgoOrigin returns where the stage of profile-guided optimization came from, for "qb config".
+func pgoOrigin(stage PGOType) string {
+	if stage == PGOOff {
+		return "default"
+	}
+	return "qb pgo"
+}
+
+func commandPGO(args []string) int {
+	if len(args) != 1 {
+		log.Fatal("Usage: qb pgo <generate|use|off>")
+		return 1
+	}
+
+	switch args[0] {
+	case "generate":
+		// Start over with new profiles, as profiles of an older build don't match the code anymore
+		os.RemoveAll(pgoStatePath)
+		err := savePGOStage(PGOGenerate)
+		if err != nil {
+			log.Fatal("Unable to save the profile-guided optimization stage: %s", err.Error())
+			return 1
+		}
+
+		if commandBuild(nil) != 0 {
+			return 1
+		}
+		log.Info("📈 Run the program (for example with \"qb run\") to collect profiles, then run \"qb pgo use\"")
+		return 0
+
+	case "use":
+		contexts, configs := loadProject()
+		prepareBuild(contexts, configs, true)
+
+		for _, ctx := range contexts {
+			compiler, ok := ctx.Compiler.(PGOCompiler)
+			if !ok || ctx.CompilerOptions.PGO == PGOOff {
+				log.Fatal("%sThere are no profiles to use, run \"qb pgo generate\" first", ctx.logPrefix())
+				return 1
+			}
+
+			err := compiler.MergeProfiles(ctx.CompilerOptions.ProfilePath)
+			if err != nil {
+				log.Fatal("%sUnable to use the profiles: %s", ctx.logPrefix(), err.Error())
+				return 1
+			}
+			ctx.CompilerOptions.PGO = PGOUse
+		}
+
+		err := savePGOStage(PGOUse)
+		if err != nil {
+			log.Fatal("Unable to save the profile-guided optimization stage: %s", err.Error())
+			return 1
+		}
+
+		if _, ok := buildAll(contexts); !ok {
+			return 1
+		}
+		return 0
+
+	case "off":
+		err := os.RemoveAll(pgoStatePath)
+		if err != nil {
+			log.Fatal("Unable to remove the profiles: %s", err.Error())
+			return 1
+		}
+		log.Info("Profile-guided optimization is off for the next build")
+		return 0
+	}
+
+	log.Fatal("Unknown profile-guided optimization stage %s%s", args[0], didYouMean(args[0], []string{"generate", "use", "off"}))
+	return 1
+}
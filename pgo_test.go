@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// pgoTestCompiler is a compiler that supports profile-guided optimization.
+type pgoTestCompiler struct {
+	mingwCompiler
+}
+
+func (ci pgoTestCompiler) MergeProfiles(profilePath string) error {
+	return nil
+}
+
+func TestLoadPGOState(t *testing.T) {
+	tests := []struct {
+		name          string
+		stage         string
+		compiler      Compiler
+		configuration string
+		want          PGOType
+		profilePath   string
+		issue         bool
+	}{
+		{
+			name:     "no state",
+			compiler: pgoTestCompiler{},
+			want:     PGOOff,
+		},
+		{
+			name:        "generate",
+			stage:       "generate\n",
+			compiler:    pgoTestCompiler{},
+			want:        PGOGenerate,
+			profilePath: "default",
+		},
+		{
+			name:          "use",
+			stage:         "use\n",
+			compiler:      pgoTestCompiler{},
+			configuration: "release",
+			want:          PGOUse,
+			profilePath:   "release",
+		},
+		{
+			name:     "corrupt state",
+			stage:    "\x00garbage",
+			compiler: pgoTestCompiler{},
+			want:     PGOOff,
+			issue:    true,
+		},
+		{
+			name:     "compiler without profile-guided optimization",
+			stage:    "use\n",
+			compiler: mingwCompiler{},
+			want:     PGOOff,
+			issue:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chdir(t, t.TempDir())
+			resetConfig(t)
+			if test.stage != "" {
+				os.MkdirAll(pgoStatePath, 0777)
+				if err := os.WriteFile(filepath.Join(pgoStatePath, "stage"), []byte(test.stage), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ctx := NewContext(test.compiler)
+			ctx.ConfigurationName = test.configuration
+			loadPGOState(ctx)
+
+			if ctx.CompilerOptions.PGO != test.want {
+				t.Errorf("PGO = %s, want %s", ctx.CompilerOptions.PGO, test.want)
+			}
+
+			profilePath := ""
+			if test.profilePath != "" {
+				profilePath, _ = filepath.Abs(filepath.Join(pgoStatePath, test.profilePath))
+			}
+			if ctx.CompilerOptions.ProfilePath != profilePath {
+				t.Errorf("ProfilePath = %q, want %q", ctx.CompilerOptions.ProfilePath, profilePath)
+			}
+
+			if issue := len(configIssues) > 0; issue != test.issue {
+				t.Errorf("configuration issues = %q, want an issue %t", configIssues, test.issue)
+			}
+		})
+	}
+}
+
+func TestSavePGOStage(t *testing.T) {
+	chdir(t, t.TempDir())
+	resetConfig(t)
+
+	for _, stage := range []PGOType{PGOGenerate, PGOUse} {
+		if err := savePGOStage(stage); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := NewContext(pgoTestCompiler{})
+		loadPGOState(ctx)
+		if ctx.CompilerOptions.PGO != stage {
+			t.Errorf("loaded stage %s after saving %s", ctx.CompilerOptions.PGO, stage)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/codecat/go-libs/log"
+	"github.com/spf13/pflag"
+)
+
+// pluginConfiguration is the resolved project configuration of a single configuration, as passed to plugins.
+type pluginConfiguration struct {
+	Configuration string           `json:"configuration"`
+	Name          string           `json:"name"`
+	Type          LinkType         `json:"type"`
+	OutPath       string           `json:"out"`
+	OutputFile    string           `json:"output"`
+	Toolset       string           `json:"toolset"`
+	Version       string           `json:"version"`
+	SourceFiles   []string         `json:"sources"`
+	Options       *CompilerOptions `json:"options"`
+}
+
+// findPlugin looks for an external command in the command line arguments. If the first argument that is not a
+// flag is not one of qb's own commands, and a "qb-<name>" executable exists in the PATH, it returns the path to that
+// executable, along with the index of the command in the arguments.
+func findPlugin(args []string) (string, int) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if findCommand(arg) != nil {
+				break
+			}
+			pluginPath, err := exec.LookPath("qb-" + arg)
+			if err != nil {
+				break
+			}
+			return pluginPath, i
+		}
+
+		// Skip the value of flags that take one, if it's not given with "="
+		if strings.Contains(arg, "=") {
+			continue
+		}
+		var flag *pflag.Flag
+		if strings.HasPrefix(arg, "--") {
+			flag = pflag.Lookup(arg[2:])
+		} else {
+			flag = pflag.CommandLine.ShorthandLookup(arg[len(arg)-1:])
+		}
+		if flag != nil && flag.NoOptDefVal == "" {
+			i++
+		}
+	}
+	return "", -1
+}
+
+// runPlugin runs an external command with the given arguments, passing it the resolved project configuration as
+// JSON in a temporary file of which the path is in the QB_PROJECT_FILE environment variable. The configuration can be
+// too large for an environment variable in projects with many files. It returns the exit code of the plugin.
+//
+// Resolving the configuration requires a working compiler, as the output file and toolset depend on it, so plugins
+// can't run on a system without one.
+func runPlugin(pluginPath string, args []string) int {
+	contexts, configs := loadProject()
+	prepareBuild(contexts, configs, false)
+
+	project := make([]pluginConfiguration, len(contexts))
+	for i, ctx := range contexts {
+		outPath := filepath.Join(ctx.OutPath, ctx.Name)
+		project[i] = pluginConfiguration{
+			Configuration: ctx.ConfigurationName,
+			Name:          ctx.Name,
+			Type:          ctx.Type,
+			OutPath:       ctx.OutPath,
+			OutputFile:    ctx.Compiler.OutputFile(outPath, ctx.Type),
+			Toolset:       ctx.Compiler.Toolset(),
+			Version:       ctx.Compiler.Version(),
+			SourceFiles:   ctx.SourceFiles,
+			Options:       ctx.CompilerOptions,
+		}
+	}
+
+	projectJSON, err := json.Marshal(project)
+	if err != nil {
+		log.Fatal("Unable to encode project configuration: %s", err.Error())
+		return 1
+	}
+
+	projectFile, err := os.CreateTemp("", "qb_project_*.json")
+	if err != nil {
+		log.Fatal("Unable to write project configuration: %s", err.Error())
+		return 1
+	}
+	defer os.Remove(projectFile.Name())
+
+	_, err = projectFile.Write(projectJSON)
+	projectFile.Close()
+	if err != nil {
+		log.Fatal("Unable to write project configuration: %s", err.Error())
+		return 1
+	}
+
+	qbPath, _ := os.Executable()
+
+	cmd := exec.Command(pluginPath, args...)
+	cmd.Env = append(os.Environ(),
+		"QB_PROJECT_FILE="+projectFile.Name(),
+		"QB_EXECUTABLE="+qbPath,
+	)
+	return runProgram(cmd)
+}
+
+// pluginNames returns the names of all plugins that can be found in the PATH.
+func pluginNames() []string {
+	ret := make([]string, 0)
+	for _, dir := range strings.Split(os.Getenv("PATH"), string(os.PathListSeparator)) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutPrefix(entry.Name(), "qb-")
+			if !ok {
+				continue
+			}
+			name, ok = executableName(filepath.Join(dir, entry.Name()), name)
+			if ok && !slices.Contains(ret, name) {
+				ret = append(ret, name)
+			}
+		}
+	}
+	return ret
+}
+
+// executableName returns the name without its extension if the file at the given path can be run as a command, the
+// same way exec.LookPath decides it. On Windows, that's when its extension is in PATHEXT, and on other systems, when
+// it has any of the executable mode bits set.
+func executableName(path, name string) (string, bool) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.IsDir() {
+		return "", false
+	}
+
+	if runtime.GOOS != "windows" {
+		return name, fi.Mode()&0111 != 0
+	}
+
+	pathExt := os.Getenv("PATHEXT")
+	if pathExt == "" {
+		pathExt = ".com;.exe;.bat;.cmd"
+	}
+	ext := filepath.Ext(name)
+	for _, executableExt := range strings.Split(pathExt, ";") {
+		if ext != "" && strings.EqualFold(ext, executableExt) {
+			return strings.TrimSuffix(name, ext), true
+		}
+	}
+	return "", false
+}
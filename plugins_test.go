@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+// writePath writes files to a new directory that becomes the only directory in the PATH. The files are
+// executable if their mode says so, or on Windows, if their extension is in PATHEXT.
+func writePath(t *testing.T, files map[string]os.FileMode) string {
+	dir := t.TempDir()
+	for name, mode := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv("PATHEXT", ".COM;.EXE;.BAT")
+	return dir
+}
+
+func TestFindPlugin(t *testing.T) {
+	plugin := "qb-deploy"
+	if runtime.GOOS == "windows" {
+		plugin += ".exe"
+	}
+	dir := writePath(t, map[string]os.FileMode{plugin: 0755})
+	parseFlags(t)
+
+	tests := []struct {
+		args  []string
+		index int
+	}{
+		{[]string{"deploy"}, 0},
+		{[]string{"deploy", "--profile", "release"}, 0},
+		{[]string{"--profile", "release", "deploy"}, 2},
+		{[]string{"--profile=release", "deploy"}, 1},
+		{[]string{"--verbose", "deploy"}, 1},
+		{[]string{"-h", "deploy"}, 1},
+		{[]string{"--profile", "deploy"}, -1},
+		{[]string{"--profile", "deploy", "deploy"}, 2},
+		{[]string{"build", "deploy"}, -1},
+		{[]string{"--", "deploy"}, -1},
+		{[]string{"lint"}, -1},
+		{[]string{}, -1},
+	}
+
+	for _, test := range tests {
+		path, index := findPlugin(test.args)
+		if index != test.index {
+			t.Errorf("findPlugin(%q) index = %d, want %d", test.args, index, test.index)
+		}
+
+		wantPath := ""
+		if test.index >= 0 {
+			wantPath = filepath.Join(dir, plugin)
+		}
+		if path != wantPath {
+			t.Errorf("findPlugin(%q) path = %q, want %q", test.args, path, wantPath)
+		}
+	}
+}
+
+func TestPluginNames(t *testing.T) {
+	files := map[string]os.FileMode{
+		"qb-deploy": 0755,
+		"qb-notes":  0644,
+		"qb-user":   0700,
+		"deploy":    0755,
+	}
+	want := []string{"deploy", "user"}
+	if runtime.GOOS == "windows" {
+		files = map[string]os.FileMode{
+			"qb-deploy.exe": 0666,
+			"qb-lint.BAT":   0666,
+			"qb-notes.txt":  0666,
+			"qb-user":       0666,
+			"deploy.exe":    0666,
+		}
+		want = []string{"deploy", "lint"}
+	}
+	dir := writePath(t, files)
+	if err := os.Mkdir(filepath.Join(dir, "qb-dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	got := pluginNames()
+	slices.Sort(got)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+// optionList is a list in the compiler options of which we track where its entries came from. The name identifies
+// the list in the JSON output of "qb config", and the label names the options and environment variables that set it.
+type optionList struct {
+	name    string
+	label   string
+	entries *[]string
+}
+
+// lists returns the lists in the compiler options of which we track where their entries came from.
+func (options *CompilerOptions) lists() []optionList {
+	return []optionList{
+		{"include", "include", &options.IncludeDirectories},
+		{"linkdir", "linkdir", &options.LinkDirectories},
+		{"link", "link", &options.LinkLibraries},
+		{"define", "define", &options.Defines},
+		{"cflags", "cflags, CPPFLAGS", &options.CompilerFlagsCXX},
+		{"cxxflags", "cxxflags, CXXFLAGS", &options.CompilerFlagsCPP},
+		{"CFLAGS", "CFLAGS", &options.CompilerFlagsC},
+		{"ldflags", "ldflags, LDFLAGS", &options.LinkerFlags},
+	}
+}
+
+// trackOrigins calls fn and remembers that all entries it adds to the compiler options came from the origin it
+// returns.
+func (ctx *Context) trackOrigins(fn func() string) {
+	lengths := ctx.optionListLengths()
+	origin := fn()
+	ctx.addOrigins(lengths, func(string) string {
+		return origin
+	})
+}
+
+// trackSettingOrigins calls fn and remembers that all entries it adds to the compiler options came from the given
+// setting of the configuration.
+func (ctx *Context) trackSettingOrigins(config *Configuration, key string, fn func()) {
+	lengths := ctx.optionListLengths()
+	fn()
+	ctx.addOrigins(lengths, func(entry string) string {
+		return config.Origin(key, entry)
+	})
+}
+
+// Origins returns where each entry in the given compiler options list came from.
+func (ctx *Context) Origins(list optionList) []string {
+	ret := ctx.origins[list.name]
+	for len(ret) < len(*list.entries) {
+		ret = append(ret, "unknown")
+	}
+	return ret
+}
+
+func (ctx *Context) optionListLengths() []int {
+	lists := ctx.CompilerOptions.lists()
+	ret := make([]int, len(lists))
+	for i, list := range lists {
+		ret[i] = len(*list.entries)
+	}
+	return ret
+}
+
+func (ctx *Context) addOrigins(lengths []int, origin func(entry string) string) {
+	if ctx.origins == nil {
+		ctx.origins = make(map[string][]string)
+	}
+
+	for i, list := range ctx.CompilerOptions.lists() {
+		origins := ctx.origins[list.name]
+		for len(origins) < lengths[i] {
+			origins = append(origins, "unknown")
+		}
+		for _, entry := range (*list.entries)[lengths[i]:] {
+			origins = append(origins, origin(entry))
+		}
+		ctx.origins[list.name] = origins
+	}
+}
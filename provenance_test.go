@@ -0,0 +1,68 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestConfigurationOrigin(t *testing.T) {
+	root := t.TempDir()
+	common := filepath.Join(root, "common")
+	project := filepath.Join(root, "project")
+	for _, dir := range []string{common, project} {
+		if err := os.Mkdir(dir, 0777); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files := map[string]string{
+		filepath.Join(common, "qb.toml"): "name = \"common\"\ntype = \"lib\"\nstrict = true\ndefine = [\"COMMON\"]\n\n" +
+			"[toolset.gcc]\ndefine = [\"GCC\"]\n",
+		filepath.Join(project, "qb.toml"): "extends = \"../common/qb.toml\"\ntype = \"exe\"\ndefine = [\"PROJECT\"]\n\n" +
+			"[os." + runtime.GOOS + "]\ndefine = [\"OS\"]\n\n" +
+			"[toolset.gcc]\noptimize = \"speed\"\n\n[toolset.msvc]\noptimize = \"size\"\n",
+	}
+	for path, config := range files {
+		if err := os.WriteFile(path, []byte(config), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Setenv("QB_STRICT", "false")
+	chdir(t, project)
+	resetConfig(t)
+	parseFlags(t)
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyToolsetConfig("gcc"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The extended configuration file is outside of the project, so it's shown with its full path
+	commonFile := filepath.Join(common, "qb.toml")
+
+	tests := []struct {
+		key, entry string
+		want       string
+	}{
+		{"name", "", commonFile},
+		{"type", "", "qb.toml"},
+		{"define", "COMMON", commonFile},
+		{"define", "PROJECT", "qb.toml"},
+		{"define", "OS", "qb.toml [os." + runtime.GOOS + "]"},
+		{"define", "GCC", commonFile + " [toolset.gcc]"},
+		{"optimize", "", "qb.toml [toolset.gcc]"},
+		{"strict", "", "environment variable QB_STRICT"},
+		{"static", "", "default"},
+	}
+
+	config := &Configuration{}
+	for _, test := range tests {
+		if got := config.Origin(test.key, test.entry); got != test.want {
+			t.Errorf("Origin(%q, %q) = %q, want %q", test.key, test.entry, got, test.want)
+		}
+	}
+}
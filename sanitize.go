@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// sanitizerConflicts are the pairs of sanitizers that can't be used in the same program, as they each need their own
+// runtime and memory layout.
+var sanitizerConflicts = [][2]string{
+	{"address", "thread"},
+	{"address", "memory"},
+	{"thread", "memory"},
+	{"thread", "leak"},
+	{"memory", "leak"},
+}
+
+// checkSanitizers returns an error if the sanitizers in the options can't be combined with each other, or with the
+// other options.
+func checkSanitizers(options *CompilerOptions) error {
+	for _, conflict := range sanitizerConflicts {
+		if slices.Contains(options.Sanitize, conflict[0]) && slices.Contains(options.Sanitize, conflict[1]) {
+			return fmt.Errorf("the %s and %s sanitizers can't be used together", conflict[0], conflict[1])
+		}
+	}
+
+	// Sanitizer reports need debug information to show where things went wrong, which would be stripped again
+	if len(options.Sanitize) > 0 && options.DebugInfo == DebugInfoNone {
+		return errors.New("sanitizers need debug information for their reports, so they can't be used with debuginfo none")
+	}
+	return nil
+}
+
+// sanitizeFlag returns the -fsanitize= flag for the given sanitizers, or an empty string if there are none.
+func sanitizeFlag(sanitizers []string) string {
+	if len(sanitizers) == 0 {
+		return ""
+	}
+	return "-fsanitize=" + strings.Join(sanitizers, ",")
+}
+
+// sanitizeReport returns the sanitizers as a single value for "qb config".
+func sanitizeReport(sanitizers []string) string {
+	if len(sanitizers) == 0 {
+		return "none"
+	}
+	return strings.Join(sanitizers, ",")
+}
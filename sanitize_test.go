@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCheckSanitizers(t *testing.T) {
+	tests := []struct {
+		sanitizers []string
+		debugInfo  DebugInfoType
+		valid      bool
+	}{
+		{nil, DebugInfoEmbedded, true},
+		{nil, DebugInfoNone, true},
+		{[]string{"address"}, DebugInfoEmbedded, true},
+		{[]string{"address", "undefined"}, DebugInfoEmbedded, true},
+		{[]string{"address", "leak"}, DebugInfoSplit, true},
+		{[]string{"thread", "undefined"}, DebugInfoEmbedded, true},
+		{[]string{"address", "thread"}, DebugInfoEmbedded, false},
+		{[]string{"address", "memory"}, DebugInfoEmbedded, false},
+		{[]string{"thread", "memory"}, DebugInfoEmbedded, false},
+		{[]string{"thread", "leak"}, DebugInfoEmbedded, false},
+		{[]string{"memory", "leak"}, DebugInfoEmbedded, false},
+		{[]string{"undefined"}, DebugInfoNone, false},
+	}
+
+	for _, test := range tests {
+		options := &CompilerOptions{Sanitize: test.sanitizers, DebugInfo: test.debugInfo}
+		if err := checkSanitizers(options); (err == nil) != test.valid {
+			t.Errorf("checkSanitizers(%v, %s) = %v, want valid %t", test.sanitizers, test.debugInfo, err, test.valid)
+		}
+	}
+}
+
+func TestSanitizeFlag(t *testing.T) {
+	tests := []struct {
+		sanitizers []string
+		flag       string
+		report     string
+	}{
+		{nil, "", "none"},
+		{[]string{"address"}, "-fsanitize=address", "address"},
+		{[]string{"address", "undefined"}, "-fsanitize=address,undefined", "address,undefined"},
+	}
+
+	for _, test := range tests {
+		if got := sanitizeFlag(test.sanitizers); got != test.flag {
+			t.Errorf("sanitizeFlag(%v) = %q, want %q", test.sanitizers, got, test.flag)
+		}
+		if got := sanitizeReport(test.sanitizers); got != test.report {
+			t.Errorf("sanitizeReport(%v) = %q, want %q", test.sanitizers, got, test.report)
+		}
+	}
+}
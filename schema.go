@@ -0,0 +1,280 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/codecat/go-libs/log"
+	"github.com/spf13/pflag"
+)
+
+// optionValues are the values accepted by options that only take a limited set of values.
+var optionValues = map[string][]string{
+	"type":          {"exe", "dll", "lib"},
+	"exceptions":    {"std", "standard", "all", "min", "minimal"},
+	"optimize":      {"default", "none", "size", "speed"},
+	"cppstd":        {"latest", "26", "23", "20", "17", "14"},
+	"cstd":          {"latest", "23", "17", "11"},
+	"stdlib":        {"default", "libc++", "libstdc++"},
+	"linker":        {"default", "lld", "mold", "gold", "bfd"},
+	"lto":           {"off", "thin", "full"},
+	"debuginfo":     {"embedded", "split", "none"},
+	"sanitize":      {"address", "undefined", "thread", "memory", "leak"},
+	"pch-languages": {"c", "c++"},
+}
+
+// packageSettings are the settings that can be used in a [package.name] table.
+var packageSettings = []string{"includes", "linkdirs", "links", "defines", "cflags", "lflags"}
+
+// osSections are the names of the [os.name] sections.
+var osSections = []string{"linux", "windows", "darwin"}
+
+// toolsetSections are the names of the [toolset.name] sections.
+var toolsetSections = []string{"gcc", "clang", "msvc", "mingw"}
+
+// toolchainSettings are the settings that decide which compiler is used. They can't be set in profiles or toolset
+// sections, as the compiler is chosen before those are applied.
+var toolchainSettings = []string{"toolset", "target", "sysroot"}
+
+// configIssues contains the problems that were found in the configuration. These are fatal with --strict-config.
+var configIssues []string
+
+// configIssue reports a problem in the configuration.
+func configIssue(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Warn("%s", msg)
+	configIssues = append(configIssues, msg)
+}
+
+// commandFlags are the command line flags that only change the behavior of a command, and are not options.
+var commandFlags = map[string]bool{
+	"json": true,
+	"help": true,
+}
+
+// flagKey returns the configuration key that a command line flag is bound to, or an empty string if the flag is
+// not bound to a configuration key.
+func flagKey(name string) string {
+	if commandFlags[name] {
+		return ""
+	}
+	if name == "profile" {
+		return "configs"
+	}
+	return name
+}
+
+// keyFlag returns the name of the command line flag for a configuration key.
+func keyFlag(key string) string {
+	if key == "configs" {
+		return "profile"
+	}
+	return key
+}
+
+// optionTypes returns the value types of all options, keyed by their configuration key. The types are those of
+// the command line flags, so "string", "bool", "stringSlice", or "stringArray".
+func optionTypes() map[string]string {
+	ret := make(map[string]string)
+	pflag.VisitAll(func(flag *pflag.Flag) {
+		if key := flagKey(flag.Name); key != "" {
+			ret[key] = flag.Value.Type()
+		}
+	})
+	return ret
+}
+
+// validateConfig checks the settings of a configuration file for unknown settings and values of the wrong type.
+func validateConfig(path string, settings map[string]interface{}) {
+	validateOptions(path, "", settings, true)
+}
+
+// validateOptions checks a table of options. Sections like [package.name] are only allowed if tables is true.
+func validateOptions(path, prefix string, settings map[string]interface{}, tables bool) {
+	types := optionTypes()
+
+	known := make([]string, 0, len(types))
+	for key := range types {
+		known = append(known, key)
+	}
+	if tables {
+		known = append(known, "package", "profile")
+		if prefix == "" {
+			known = append(known, "extends", "os", "toolset")
+		}
+	}
+	sort.Strings(known)
+
+	for _, key := range sortedKeys(settings) {
+		value := settings[key]
+		name := prefix + key
+
+		if !slices.Contains(known, key) {
+			configIssue("%s: unknown setting \"%s\"%s", path, name, didYouMean(key, known))
+			continue
+		}
+
+		sections := strings.Split(prefix, ".")
+		if slices.Contains(toolchainSettings, key) && (slices.Contains(sections, "profile") || slices.Contains(sections, "toolset")) {
+			configIssue("%s: %s can't be set in a profile or toolset section, as it decides which compiler is used", path, name)
+			continue
+		}
+
+		switch key {
+		case "package":
+			validateTables(path, name, value, nil, func(table string, settings map[string]interface{}) {
+				validatePackage(path, name+"."+table, settings)
+			})
+
+		case "profile":
+			validateTables(path, name, value, nil, func(table string, settings map[string]interface{}) {
+				validateOptions(path, name+"."+table+".", settings, false)
+			})
+
+		case "os":
+			validateTables(path, name, value, osSections, func(table string, settings map[string]interface{}) {
+				validateOptions(path, name+"."+table+".", settings, true)
+			})
+
+		case "toolset":
+			// A string selects the toolset, while a table contains the sections for each toolset
+			if _, ok := value.(map[string]interface{}); !ok {
+				validateValue(path, name, value, types[key])
+				continue
+			}
+			if prefix != "" {
+				configIssue("%s: %s sections can only be used at the top level", path, name)
+				continue
+			}
+			validateTables(path, name, value, toolsetSections, func(table string, settings map[string]interface{}) {
+				validateOptions(path, name+"."+table+".", settings, true)
+			})
+
+		case "extends":
+			if _, ok := value.(string); !ok {
+				validateValue(path, name, value, "stringSlice")
+			}
+
+		default:
+			validateValue(path, name, value, types[key])
+		}
+	}
+}
+
+// validateTables checks a table of which each value is another table. If names is not nil, the names of the
+// tables are restricted to those.
+func validateTables(path, name string, value interface{}, names []string, validate func(string, map[string]interface{})) {
+	tables, ok := value.(map[string]interface{})
+	if !ok {
+		configIssue("%s: %s must be a table", path, name)
+		return
+	}
+
+	for _, table := range sortedKeys(tables) {
+		if names != nil && !slices.Contains(names, table) {
+			configIssue("%s: unknown section \"%s.%s\"%s", path, name, table, didYouMean(table, names))
+			continue
+		}
+
+		settings, ok := tables[table].(map[string]interface{})
+		if !ok {
+			configIssue("%s: %s.%s must be a table", path, name, table)
+			continue
+		}
+		validate(table, settings)
+	}
+}
+
+// validatePackage checks the settings of a [package.name] table.
+func validatePackage(path, name string, settings map[string]interface{}) {
+	for _, key := range sortedKeys(settings) {
+		if !slices.Contains(packageSettings, key) {
+			configIssue("%s: unknown package setting \"%s.%s\"%s", path, name, key, didYouMean(key, packageSettings))
+			continue
+		}
+		validateValue(path, name+"."+key, settings[key], "stringSlice")
+	}
+}
+
+// validateValue checks whether a value has the given option type.
+func validateValue(path, name string, value interface{}, valueType string) {
+	switch valueType {
+	case "bool":
+		if _, ok := value.(bool); !ok {
+			configIssue("%s: %s must be true or false", path, name)
+		}
+
+	case "string":
+		switch value.(type) {
+		case string, int, int64, float64:
+		default:
+			configIssue("%s: %s must be a string", path, name)
+		}
+
+	case "stringSlice", "stringArray":
+		list, ok := value.([]interface{})
+		if !ok {
+			configIssue("%s: %s must be a list of strings", path, name)
+			return
+		}
+		for _, item := range list {
+			if _, ok := item.(string); !ok {
+				configIssue("%s: %s must be a list of strings", path, name)
+				return
+			}
+		}
+	}
+}
+
+// didYouMean returns a suggestion for the candidate that is closest to the given name, or an empty string if none of
+// the candidates are close enough.
+func didYouMean(name string, candidates []string) string {
+	best := ""
+	bestDistance := len(name)/3 + 1
+	for _, candidate := range candidates {
+		distance := levenshtein(strings.ToLower(name), candidate)
+		if distance <= bestDistance && (best == "" || distance < bestDistance) {
+			best = candidate
+			bestDistance = distance
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+	return fmt.Sprintf(", did you mean \"%s\"?", best)
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	ret := make([]string, 0, len(m))
+	for key := range m {
+		ret = append(ret, key)
+	}
+	sort.Strings(ret)
+	return ret
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"", "abc", 3},
+		{"abc", "", 3},
+		{"define", "define", 0},
+		{"defin", "define", 1},
+		{"defnie", "define", 2},
+		{"incldue", "include", 2},
+		{"kitten", "sitting", 3},
+	}
+
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b); got != test.want {
+			t.Errorf("levenshtein(%q, %q) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestDidYouMean(t *testing.T) {
+	candidates := []string{"define", "include", "link", "linkdir", "static"}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"defines", ", did you mean \"define\"?"},
+		{"Include", ", did you mean \"include\"?"},
+		{"lnk", ", did you mean \"link\"?"},
+		{"linkdirs", ", did you mean \"linkdir\"?"},
+		{"static", ", did you mean \"static\"?"},
+		{"optimize", ""},
+		{"x", ""},
+	}
+
+	for _, test := range tests {
+		if got := didYouMean(test.name, candidates); got != test.want {
+			t.Errorf("didYouMean(%q) = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestValidateValue(t *testing.T) {
+	tests := []struct {
+		value     interface{}
+		valueType string
+		valid     bool
+	}{
+		{true, "bool", true},
+		{"yes", "bool", false},
+		{"app", "string", true},
+		{int64(17), "string", true},
+		{[]interface{}{"a"}, "string", false},
+		{[]interface{}{"a", "b"}, "stringSlice", true},
+		{[]interface{}{"a", int64(1)}, "stringSlice", false},
+		{"a", "stringArray", false},
+	}
+
+	for _, test := range tests {
+		configIssues = nil
+		validateValue("qb.toml", "key", test.value, test.valueType)
+		if valid := len(configIssues) == 0; valid != test.valid {
+			t.Errorf("validateValue(%v, %s) valid = %t, want %t", test.value, test.valueType, valid, test.valid)
+		}
+	}
+	configIssues = nil
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+)
+
+// reportValue is a resolved value along with a description of where it came from.
+type reportValue struct {
+	Name   string      `json:"name,omitempty"`
+	Value  interface{} `json:"value"`
+	Origin string      `json:"origin"`
+}
+
+// configReport contains the effective configuration of a single build configuration, as printed by "qb config".
+type configReport struct {
+	Configuration string                   `json:"configuration"`
+	Toolset       string                   `json:"toolset"`
+	Version       string                   `json:"version,omitempty"`
+	Target        string                   `json:"target,omitempty"`
+	Sysroot       string                   `json:"sysroot,omitempty"`
+	Project       []reportValue            `json:"project"`
+	Options       []reportValue            `json:"options"`
+	SourceFiles   []string                 `json:"sources"`
+	Lists         map[string][]reportValue `json:"lists"`
+}
+
+func newConfigReport(ctx *Context, config *Configuration) *configReport {
+	options := ctx.CompilerOptions
+
+	nameOrigin := config.Origin("name", "")
+	if config.GetString("name") == "" {
+		nameOrigin = "directory name"
+	}
+
+	outOrigin := config.Origin("out", "")
+	if config.Name != "" {
+		outOrigin += ", configuration sub-directory"
+	}
+
+	ret := &configReport{
+		Configuration: config.Name,
+		Toolset:       ctx.Compiler.Toolset(),
+		Version:       ctx.Compiler.Version(),
+		Target:        toolchain.Target,
+		Sysroot:       toolchain.Sysroot,
+		Project: []reportValue{
+			{"name", ctx.Name, nameOrigin},
+			{"type", ctx.Type.String(), config.Origin("type", "")},
+			{"out", ctx.OutPath, outOrigin},
+		},
+		Options: []reportValue{
+			{"static", options.Static, config.Origin("static", "")},
+			{"debug", options.Debug, config.Origin("debug", "")},
+			{"debuginfo", options.DebugInfo.String(), config.Origin("debuginfo", "")},
+			{"split-dwarf", options.SplitDWARF, config.Origin("split-dwarf", "")},
+			{"compress-debug", options.CompressDebug, config.Origin("compress-debug", "")},
+			{"verbose", options.Verbose, config.Origin("verbose", "")},
+			{"strict", options.Strict, config.Origin("strict", "")},
+			{"harden", options.Harden, config.Origin("harden", "")},
+			{"exceptions", options.Exceptions.String(), config.Origin("exceptions", "")},
+			{"optimize", options.Optimization.String(), config.Origin("optimize", "")},
+			{"cppstd", options.CPPStandard.String(), config.Origin("cppstd", "")},
+			{"cstd", options.CStandard.String(), config.Origin("cstd", "")},
+			{"stdlib", options.StdLib.String(), config.Origin("stdlib", "")},
+			{"linker", options.Linker.String(), config.Origin("linker", "")},
+			{"lto", options.LTO.String(), config.Origin("lto", "")},
+			{"sanitize", sanitizeReport(options.Sanitize), config.Origin("sanitize", "")},
+			{"pgo", options.PGO.String(), pgoOrigin(options.PGO)},
+			{"pch", options.PCH, config.Origin("pch", "")},
+			{"pch-languages", pchLanguagesReport(options), config.Origin("pch-languages", "")},
+		},
+		SourceFiles: ctx.SourceFiles,
+		Lists:       make(map[string][]reportValue),
+	}
+
+	for _, list := range options.lists() {
+		origins := ctx.Origins(list)
+		entries := make([]reportValue, len(*list.entries))
+		for i, entry := range *list.entries {
+			entries[i] = reportValue{Value: entry, Origin: origins[i]}
+		}
+		ret.Lists[list.name] = entries
+	}
+
+	return ret
+}
+
+// printConfig prints the effective configuration of each context, either in a human readable format or as JSON.
+func printConfig(contexts []*Context, configs []*Configuration, asJSON bool) {
+	reports := make([]*configReport, len(contexts))
+	for i, ctx := range contexts {
+		reports[i] = newConfigReport(ctx, configs[i])
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(reports)
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for i, report := range reports {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		toolset := report.Toolset
+		if report.Version != "" {
+			toolset += " " + report.Version
+		}
+		if report.Target != "" {
+			toolset += ", target " + report.Target
+		}
+		if report.Sysroot != "" {
+			toolset += ", sysroot " + report.Sysroot
+		}
+
+		if report.Configuration == "" {
+			fmt.Fprintf(w, "Default configuration (%s)\n", toolset)
+		} else {
+			fmt.Fprintf(w, "Configuration %s (%s)\n", report.Configuration, toolset)
+		}
+
+		for _, value := range report.Project {
+			fmt.Fprintf(w, "  %s\t%v\t(%s)\n", value.Name, value.Value, value.Origin)
+		}
+		for _, value := range report.Options {
+			fmt.Fprintf(w, "  %s\t%v\t(%s)\n", value.Name, value.Value, value.Origin)
+		}
+
+		fmt.Fprintf(w, "  sources\t%d files\t\n", len(report.SourceFiles))
+		for _, file := range report.SourceFiles {
+			fmt.Fprintf(w, "    %s\t\t\n", file)
+		}
+
+		for _, list := range contexts[i].CompilerOptions.lists() {
+			entries := report.Lists[list.name]
+			if len(entries) == 0 {
+				continue
+			}
+			fmt.Fprintf(w, "  %s\t\t\n", list.label)
+			for _, entry := range entries {
+				fmt.Fprintf(w, "    %v\t\t(%s)\n", entry.Value, entry.Origin)
+			}
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"runtime"
+	"strings"
+)
+
+// targetOS returns the operating system of a target triple, using the same names as GOOS. If the triple is empty,
+// the operating system of the host is returned.
+func targetOS(triple string) string {
+	if triple == "" {
+		return runtime.GOOS
+	}
+
+	for _, part := range strings.Split(triple, "-") {
+		switch {
+		case part == "windows" || strings.HasPrefix(part, "mingw") || part == "cygwin":
+			return "windows"
+		case part == "darwin" || part == "apple" || strings.HasPrefix(part, "macos"):
+			return "darwin"
+		case part == "linux":
+			return "linux"
+		}
+	}
+	return "linux"
+}
+
+// outputSuffix returns the suffix that a GNU style toolchain gives a file of the given type on the target operating
+// system.
+func outputSuffix(goos string, outType LinkType) string {
+	switch outType {
+	case LinkExe:
+		if goos == "windows" {
+			return ".exe"
+		}
+	case LinkDll:
+		switch goos {
+		case "windows":
+			return ".dll"
+		case "darwin":
+			return ".dylib"
+		}
+		return ".so"
+	case LinkLib:
+		return ".a"
+	}
+	return ""
+}
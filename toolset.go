@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// compilerInfo describes a compiler, as detected by running it.
+type compilerInfo struct {
+	// family is the compiler family, either "clang" or "gcc".
+	family string
+
+	// version is the version of the compiler, such as "13.2.0".
+	version string
+}
+
+var versionPattern = regexp.MustCompile(`\d+\.\d+(\.\d+)?`)
+
+// detectCompiler runs a compiler to find out which family it belongs to and what its version is. This also makes
+// sure that the compiler actually works.
+func detectCompiler(cc []string) (compilerInfo, error) {
+	cmd := exec.Command(cc[0], slices.Concat(cc[1:], []string{"--version"})...)
+	output, err := cmd.Output()
+	if err != nil {
+		return compilerInfo{}, fmt.Errorf("unable to run %s: %w", strings.Join(cc, " "), err)
+	}
+
+	ret := compilerInfo{family: "gcc"}
+	if strings.Contains(string(output), "clang") {
+		ret.family = "clang"
+	}
+
+	// The version is on the first line, like "gcc (Debian 12.2.0-14) 12.2.0" or "clang version 17.0.6"
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+	ret.version = versionPattern.FindString(firstLine)
+	return ret, nil
+}
+
+// checkCompilerTarget returns an error if a gcc compiler doesn't build for the target. Unlike clang, which is given
+// the target on the command line, each gcc only builds for the target it was built for.
+func checkCompilerTarget(cc []string, info compilerInfo, target string) error {
+	if info.family != "gcc" || target == "" {
+		return nil
+	}
+
+	cmd := exec.Command(cc[0], slices.Concat(cc[1:], []string{"-dumpmachine"})...)
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("unable to run %s: %w", strings.Join(cc, " "), err)
+	}
+
+	machine := strings.TrimSpace(string(output))
+	if !sameTarget(machine, target) {
+		return fmt.Errorf("%s builds for %s instead of %s, use a compiler for the target", strings.Join(cc, " "), machine, target)
+	}
+	return nil
+}
+
+// sameTarget returns true if two target triples have the same architecture and environment. The vendor is often
+// left out of a triple, so "x86_64-linux-gnu" and "x86_64-pc-linux-gnu" are the same target.
+func sameTarget(a, b string) bool {
+	if a == b {
+		return true
+	}
+	partsA := strings.Split(a, "-")
+	partsB := strings.Split(b, "-")
+	return partsA[0] == partsB[0] && partsA[len(partsA)-1] == partsB[len(partsB)-1]
+}
+
+// toolsetCommand returns the command that invokes the C compiler of a toolset. The toolset is either a compiler
+// family with an optional version suffix, like "clang" or "gcc-13", or the path to a compiler. When cross-compiling,
+// gcc is prefixed with the target, as each target has its own gcc toolchain.
+func toolsetCommand(toolset, target string) ([]string, error) {
+	command := toolset
+	if target != "" && strings.HasPrefix(toolset, "gcc") && !strings.ContainsRune(toolset, filepath.Separator) {
+		command = target + "-" + toolset
+	}
+
+	if _, err := exec.LookPath(command); err != nil {
+		return nil, fmt.Errorf("couldn't find toolset %s: %w", toolset, err)
+	}
+	return []string{command}, nil
+}
+
+// cxxCommand derives the command of the C++ compiler from the command of the C compiler, like "clang++-17" from
+// "clang-17" or "g++-13" from "gcc-13". If it can't be derived or doesn't exist, the C compiler is used.
+func cxxCommand(cc []string) []string {
+	ret := slices.Clone(cc)
+	dir, base := filepath.Split(ret[len(ret)-1])
+
+	switch {
+	case strings.Contains(base, "clang++") || strings.Contains(base, "g++"):
+	case strings.Contains(base, "clang"):
+		base = strings.Replace(base, "clang", "clang++", 1)
+	case strings.Contains(base, "gcc"):
+		base = strings.Replace(base, "gcc", "g++", 1)
+	case base == "cc":
+		base = "c++"
+	}
+
+	ret[len(ret)-1] = dir + base
+	if _, err := exec.LookPath(ret[len(ret)-1]); err != nil {
+		return cc
+	}
+	return ret
+}
+
+// ltoArchiver returns the archiver that can index objects with link-time optimization data, which is gcc-ar for gcc
+// and llvm-ar for clang. If the AR environment variable is set or no such archiver can be found, fallback is returned.
+func ltoArchiver(family string, cc []string, fallback string) string {
+	if os.Getenv("AR") != "" {
+		return fallback
+	}
+
+	name := "gcc-ar"
+	if family == "clang" {
+		name = "llvm-ar"
+	}
+	if tool := companionTool(family, cc, name); tool != "" {
+		return tool
+	}
+	return fallback
+}
+
+// companionTool returns the command of a tool that comes with the compiler, like "gcov" or "llvm-cov", or an empty
+// string if it can't be found. A prefix and version suffix of the compiler are kept, so "gcc-13" gives "gcov-13".
+func companionTool(family string, cc []string, name string) string {
+	candidates := make([]string, 0)
+	if dir, base := filepath.Split(cc[len(cc)-1]); strings.Contains(base, family) {
+		candidates = append(candidates, dir+strings.Replace(base, family, name, 1))
+	}
+	candidates = append(candidates, name)
+
+	for _, candidate := range candidates {
+		if _, err := exec.LookPath(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
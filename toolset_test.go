@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestSameTarget(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"x86_64-linux-gnu", "x86_64-linux-gnu", true},
+		{"x86_64-pc-linux-gnu", "x86_64-linux-gnu", true},
+		{"aarch64-linux-gnu", "aarch64-unknown-linux-gnu", true},
+		{"x86_64-linux-gnu", "aarch64-linux-gnu", false},
+		{"arm-linux-gnueabihf", "arm-none-eabi", false},
+		{"x86_64-linux-gnu", "x86_64-w64-mingw32", false},
+	}
+
+	for _, test := range tests {
+		if got := sameTarget(test.a, test.b); got != test.want {
+			t.Errorf("sameTarget(%q, %q) = %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestCheckCompilerTarget(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake compiler is a shell script")
+	}
+
+	cc := filepath.Join(t.TempDir(), "gcc")
+	if err := os.WriteFile(cc, []byte("#!/bin/sh\necho x86_64-pc-linux-gnu\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		family, target string
+		ok             bool
+	}{
+		{"gcc", "", true},
+		{"gcc", "x86_64-linux-gnu", true},
+		{"gcc", "aarch64-linux-gnu", false},
+		{"clang", "aarch64-linux-gnu", true},
+	}
+
+	for _, test := range tests {
+		err := checkCompilerTarget([]string{cc}, compilerInfo{family: test.family}, test.target)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("checkCompilerTarget(%s, %q) = %v, want ok %t", test.family, test.target, err, test.ok)
+		}
+	}
+}
+
+// writeCommands creates executables with the given names in a new directory that becomes the only directory in the
+// PATH, and returns that directory.
+func writeCommands(t *testing.T, names ...string) string {
+	files := make(map[string]os.FileMode)
+	for _, name := range names {
+		if runtime.GOOS == "windows" {
+			name += ".exe"
+		}
+		files[name] = 0755
+	}
+	return writePath(t, files)
+}
+
+func TestCxxCommand(t *testing.T) {
+	dir := writeCommands(t, "clang++-17", "g++-13", "x86_64-linux-gnu-g++-12", "g++", "c++")
+	gcc := filepath.Join(dir, "gcc")
+
+	tests := []struct {
+		cc   []string
+		want []string
+	}{
+		{[]string{"clang-17"}, []string{"clang++-17"}},
+		{[]string{"clang-16"}, []string{"clang-16"}},
+		{[]string{"gcc-13"}, []string{"g++-13"}},
+		{[]string{"x86_64-linux-gnu-gcc-12"}, []string{"x86_64-linux-gnu-g++-12"}},
+		{[]string{"ccache", "gcc"}, []string{"ccache", "g++"}},
+		{[]string{gcc}, []string{filepath.Join(dir, "g++")}},
+		{[]string{"cc"}, []string{"c++"}},
+		{[]string{"g++-13"}, []string{"g++-13"}},
+		{[]string{"tcc"}, []string{"tcc"}},
+	}
+
+	for _, test := range tests {
+		if got := cxxCommand(test.cc); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("cxxCommand(%q) = %q, want %q", test.cc, got, test.want)
+		}
+	}
+}
+
+func TestCompanionTool(t *testing.T) {
+	writeCommands(t, "gcov-13", "x86_64-linux-gnu-gcc-ar-12", "gcc-ar", "llvm-cov", "llvm-ar-18")
+
+	tests := []struct {
+		family string
+		cc     []string
+		name   string
+		want   string
+	}{
+		{"gcc", []string{"gcc-13"}, "gcov", "gcov-13"},
+		{"gcc", []string{"gcc-12"}, "gcov", ""},
+		{"gcc", []string{"x86_64-linux-gnu-gcc-12"}, "gcc-ar", "x86_64-linux-gnu-gcc-ar-12"},
+		{"gcc", []string{"ccache", "gcc"}, "gcc-ar", "gcc-ar"},
+		{"gcc", []string{"cc"}, "gcc-ar", "gcc-ar"},
+		{"clang", []string{"clang-17"}, "llvm-cov", "llvm-cov"},
+		{"clang", []string{"clang-18"}, "llvm-ar", "llvm-ar-18"},
+		{"clang", []string{"clang"}, "llvm-ar", ""},
+	}
+
+	for _, test := range tests {
+		if got := companionTool(test.family, test.cc, test.name); got != test.want {
+			t.Errorf("companionTool(%s, %q, %s) = %q, want %q", test.family, test.cc, test.name, got, test.want)
+		}
+	}
+}
+
+func TestLtoArchiver(t *testing.T) {
+	writeCommands(t, "gcc-ar", "gcc-ar-13", "x86_64-linux-gnu-gcc-ar", "llvm-ar-17")
+
+	tests := []struct {
+		family string
+		cc     []string
+		ar     string
+		want   string
+	}{
+		{"gcc", []string{"gcc"}, "", "gcc-ar"},
+		{"gcc", []string{"gcc-13"}, "", "gcc-ar-13"},
+		{"gcc", []string{"x86_64-linux-gnu-gcc"}, "", "x86_64-linux-gnu-gcc-ar"},
+		{"clang", []string{"clang-17"}, "", "llvm-ar-17"},
+		{"clang", []string{"clang"}, "", "ar"},
+		{"gcc", []string{"gcc"}, "my-ar", "ar"},
+	}
+
+	for _, test := range tests {
+		t.Setenv("AR", test.ar)
+		if got := ltoArchiver(test.family, test.cc, "ar"); got != test.want {
+			t.Errorf("ltoArchiver(%s, %q) with AR=%q = %q, want %q", test.family, test.cc, test.ar, got, test.want)
+		}
+	}
+}